@@ -11,7 +11,7 @@ import (
 func main() {
 	cfg := config.MustLoad()
 	log := logger.New(cfg.Env)
-	app := apppkg.New(log, cfg.Env, cfg.Port, cfg.DB, cfg.JWT)
+	app := apppkg.New(log, cfg.Env, cfg.Port, cfg.DB, cfg.JWT, cfg.Auth, cfg.Mail)
 
 	app.TaskManager.Run()
 
@@ -3,6 +3,8 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"gorm.io/gorm"
 	"log/slog"
 	serverapp "markup/internal/app/server"
 	"markup/internal/background"
@@ -10,6 +12,11 @@ import (
 	"markup/internal/controllers"
 	//"markup/internal/db/mysql"
 	"markup/internal/db/postgres"
+	"markup/internal/lib/jwt"
+	"markup/internal/lib/loginlimit"
+	"markup/internal/lib/mailer"
+	"markup/internal/lib/oidc"
+	"markup/internal/lib/password"
 	"markup/internal/repos"
 	"markup/internal/server"
 	"markup/internal/services"
@@ -33,6 +40,8 @@ func New(
 	port int,
 	dbConfig config.DB,
 	jwtConfig config.JWT,
+	authConfig config.Auth,
+	mailConfig config.Mail,
 ) *App {
 	//db, err := mysql.New(dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Pass, dbConfig.DBName)
 	db, err := postgres.New(dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Pass, dbConfig.DBName)
@@ -40,6 +49,29 @@ func New(
 		panic(err)
 	}
 
+	keySet, err := newKeySet(jwtConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	limiter, err := newLoginLimiter(db, authConfig.LoginLimit)
+	if err != nil {
+		panic(err)
+	}
+
+	mail, err := newMailer(log, mailConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	policy := password.Policy{
+		MinLength:     authConfig.Password.MinLength,
+		RequireUpper:  authConfig.Password.RequireUpper,
+		RequireLower:  authConfig.Password.RequireLower,
+		RequireDigit:  authConfig.Password.RequireDigit,
+		RequireSymbol: authConfig.Password.RequireSymbol,
+	}
+
 	helloRepo := repos.NewHello(db)
 
 	helloService := services.NewHelloService(log, helloRepo)
@@ -49,14 +81,51 @@ func New(
 	batchCon := controllers.NewBatch(log, db)
 	markupCon := controllers.NewMarkup(log, db)
 	assessmentCon := controllers.NewAssessment(log, db)
-	authCon := controllers.NewAuth(log, db, jwtConfig.Secret)
+	authCon := controllers.NewAuth(log, db, keySet, limiter, policy, !authConfig.InviteOnly)
 	profileCon := controllers.NewProfile(log, db)
 	honeypotCon := controllers.NewHoneypot(log, db)
+	permissionCon := controllers.NewPermission(log, db)
+	organizationCon := controllers.NewOrganization(log, db)
+	userCon := controllers.NewUser(log, db, limiter, policy)
+	inviteCon := controllers.NewInvite(log, db)
+	apiKeyCon := controllers.NewAPIKey(log, db)
+	oidcCon := controllers.NewOIDC(
+		log,
+		db,
+		keySet,
+		oidc.Config{
+			Issuer:       authConfig.OIDC.Issuer,
+			ClientID:     authConfig.OIDC.ClientID,
+			ClientSecret: authConfig.OIDC.ClientSecret,
+			RedirectURL:  authConfig.OIDC.RedirectURL,
+			Scopes:       authConfig.OIDC.Scopes,
+		},
+		controllers.OIDCOptions{
+			Enabled:     authConfig.OIDC.Enabled,
+			DefaultRole: authConfig.OIDC.DefaultRole,
+			GroupsClaim: authConfig.OIDC.GroupsClaim,
+			GroupRoles:  authConfig.OIDC.GroupRoles,
+			FrontendURL: authConfig.OIDC.FrontendURL,
+			LinkByEmail: authConfig.OIDC.LinkByEmail,
+		},
+	)
+	passwordCon := controllers.NewPassword(
+		log,
+		db,
+		keySet,
+		limiter,
+		mail,
+		policy,
+		authConfig.Password.ResetURL,
+		authConfig.Password.ResetTTL,
+	)
+	auditLogCon := controllers.NewAuditLog(log, db)
+	earningsCon := controllers.NewEarnings(log, db)
 
 	router := server.NewRouter(
 		log,
 		env,
-		jwtConfig.Secret,
+		keySet,
 		db,
 		helloCon,
 		markupTypeCon,
@@ -66,6 +135,15 @@ func New(
 		authCon,
 		profileCon,
 		honeypotCon,
+		permissionCon,
+		organizationCon,
+		userCon,
+		inviteCon,
+		apiKeyCon,
+		oidcCon,
+		passwordCon,
+		auditLogCon,
+		earningsCon,
 	)
 	serverApp := serverapp.New(log, port, router)
 
@@ -76,3 +154,57 @@ func New(
 		TaskManager: tm,
 	}
 }
+
+// newKeySet loads signing keys described by cfg. Shared secret is used if no keys are configured.
+func newKeySet(cfg config.JWT) (*jwt.KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		return jwt.NewHMACKeySet(cfg.Secret), nil
+	}
+
+	keys := make([]jwt.Key, len(cfg.Keys))
+	for i, key := range cfg.Keys {
+		var err error
+		keys[i], err = jwt.LoadKey(key.ID, key.Algorithm, key.PrivateKeyPath, key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jwt.NewKeySet(cfg.ActiveKey, keys...)
+}
+
+// newLoginLimiter creates limiter of failed sign in attempts with store described by cfg.
+func newLoginLimiter(db *gorm.DB, cfg config.LoginLimit) (*loginlimit.Limiter, error) {
+	var store loginlimit.Store
+	switch cfg.Store {
+	case "memory":
+		store = loginlimit.NewMemoryStore()
+	case "postgres":
+		store = loginlimit.NewPostgresStore(db)
+	default:
+		return nil, fmt.Errorf("unknown login limit store %q", cfg.Store)
+	}
+
+	ip := loginlimit.Rule{
+		Threshold:   cfg.IPThreshold,
+		BaseLockout: cfg.BaseLockout,
+		MaxLockout:  cfg.MaxLockout,
+		Window:      cfg.Window,
+	}
+	account := ip
+	account.Threshold = cfg.AccountThreshold
+
+	return loginlimit.New(store, ip, account), nil
+}
+
+// newMailer creates mailer of driver described by cfg.
+func newMailer(log *slog.Logger, cfg config.Mail) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return mailer.NewLogMailer(log), nil
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.Host, cfg.Port, cfg.User, cfg.Pass, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
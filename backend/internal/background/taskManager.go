@@ -1,9 +1,17 @@
 package background
 
 import (
+	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"log/slog"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/enums/jobStatus"
+	"markup/internal/domain/enums/markupStatus"
 	"markup/internal/domain/models"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/ledger"
+	"markup/internal/lib/lifecycle"
 	"time"
 )
 
@@ -21,6 +29,12 @@ func NewTaskManager(log *slog.Logger, db *gorm.DB) *TaskManager {
 
 func (tm *TaskManager) Run() {
 	go tm.deleteOutdatedAssessments()
+	go tm.deleteExpiredRefreshTokens()
+	go tm.deleteStaleLoginThrottles()
+	go tm.deleteExpiredPasswordResets()
+	go tm.processAssessmentInvalidations()
+	go tm.runBatchSchedule()
+	go tm.settleEarnings()
 }
 
 func (tm *TaskManager) deleteOutdatedAssessments() {
@@ -34,3 +48,274 @@ func (tm *TaskManager) deleteOutdatedAssessments() {
 		time.Sleep(5 * time.Second)
 	}
 }
+
+func (tm *TaskManager) deleteExpiredRefreshTokens() {
+	for {
+		err := tm.db.
+			Where("expires_at < ?", time.Now()).
+			Delete(models.RefreshToken{}).Error
+		if err != nil {
+			tm.log.Error("failed to delete expired refresh tokens", slog.Any("error", err))
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func (tm *TaskManager) deleteStaleLoginThrottles() {
+	for {
+		err := tm.db.
+			Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", time.Now().Add(-24*time.Hour), time.Now()).
+			Delete(models.LoginThrottle{}).Error
+		if err != nil {
+			tm.log.Error("failed to delete stale login throttles", slog.Any("error", err))
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func (tm *TaskManager) deleteExpiredPasswordResets() {
+	for {
+		err := tm.db.
+			Where("expires_at < ?", time.Now()).
+			Delete(models.PasswordReset{}).Error
+		if err != nil {
+			tm.log.Error("failed to delete expired password resets", slog.Any("error", err))
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func (tm *TaskManager) processAssessmentInvalidations() {
+	for {
+		for {
+			processed, err := tm.processAssessmentInvalidation()
+			if err != nil {
+				tm.log.Error("failed to process assessment invalidation", slog.Any("error", err))
+			}
+			if !processed {
+				break
+			}
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// processAssessmentInvalidation runs the oldest pending models.AssessmentInvalidation.
+// Reports whether there was a job to run.
+func (tm *TaskManager) processAssessmentInvalidation() (bool, error) {
+	const op = "TaskManager.processAssessmentInvalidation"
+
+	var job models.AssessmentInvalidation
+	err := tm.db.
+		Preload("Batches").
+		Where("status_id = ?", jobStatus.Pending).
+		Order("id").
+		First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Condition on status guarantees that job is run once if several instances of application are running.
+	result := tm.db.Model(&models.AssessmentInvalidation{}).
+		Where("id = ? AND status_id = ?", job.ID, jobStatus.Pending).
+		Update("status_id", jobStatus.Running)
+	if err := result.Error; err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if result.RowsAffected == 0 {
+		return true, nil
+	}
+
+	err = tm.db.Transaction(func(tx *gorm.DB) error {
+		return invalidateAssessments(tx, &job)
+	})
+	if err != nil {
+		message := err.Error()
+		updateErr := tm.db.Model(&models.AssessmentInvalidation{}).
+			Where("id = ?", job.ID).
+			Updates(map[string]any{
+				"status_id":   jobStatus.Failed,
+				"error":       message,
+				"finished_at": time.Now(),
+			}).Error
+		if updateErr != nil {
+			tm.log.Error("failed to mark assessment invalidation as failed", slog.Any("error", updateErr))
+		}
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// invalidateAssessments invalidates assessments matching job, recalculates consensus of their markups
+// and saves summary of job.
+func invalidateAssessments(tx *gorm.DB, job *models.AssessmentInvalidation) error {
+	filter := tx.Model(&models.Assessment{}).
+		Where("user_id = ? AND hash IS NOT NULL AND invalidated_at IS NULL", job.UserID)
+	if job.From != nil {
+		filter = filter.Where("created_at >= ?", *job.From)
+	}
+	if job.To != nil {
+		filter = filter.Where("created_at < ?", *job.To)
+	}
+	if len(job.Batches) > 0 {
+		batchIDs := make([]uint, len(job.Batches))
+		for i, batch := range job.Batches {
+			batchIDs[i] = batch.ID
+		}
+		filter = filter.Where("markup_id IN (SELECT id FROM markups WHERE batch_id IN ?)", batchIDs)
+	}
+
+	var markupIDs []uint
+	if err := filter.Session(&gorm.Session{}).Distinct("markup_id").Pluck("markup_id", &markupIDs).Error; err != nil {
+		return err
+	}
+
+	result := filter.Session(&gorm.Session{}).UpdateColumns(map[string]any{
+		"invalidated_at":  time.Now(),
+		"invalidation_id": job.ID,
+	})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	// Earnings of assessments that were already settled are cancelled.
+	var settledIDs []uint
+	err := tx.Model(&models.Assessment{}).
+		Where("invalidation_id = ?", job.ID).
+		Where("settled_at IS NOT NULL").
+		Pluck("id", &settledIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range settledIDs {
+		if err := ledger.Reverse(tx, id); err != nil {
+			return err
+		}
+	}
+
+	changed := 0
+	for _, markupID := range markupIDs {
+		statusChanged, err := consensus.Recalculate(tx, markupID)
+		if err != nil {
+			return err
+		}
+		if statusChanged {
+			changed++
+		}
+	}
+
+	now := time.Now()
+	job.StatusID = jobStatus.Finished
+	job.AssessmentCount = int(result.RowsAffected)
+	job.MarkupCount = len(markupIDs)
+	job.ChangedMarkupCount = changed
+	job.FinishedAt = &now
+
+	return tx.Model(job).Select("status_id", "assessment_count", "markup_count", "changed_markup_count", "finished_at").
+		Updates(job).Error
+}
+
+// runBatchSchedule activates scheduled batches at their starts_at, completes active batches whose markups
+// are all processed and pauses remaining active batches at their ends_at.
+func (tm *TaskManager) runBatchSchedule() {
+	for {
+		now := time.Now()
+
+		tm.transitionBatches(
+			batchStatus.Active,
+			tm.db.Where("status_id = ? AND starts_at <= ?", batchStatus.Scheduled, now),
+		)
+		tm.transitionBatches(
+			batchStatus.Completed,
+			tm.db.
+				Where("status_id = ? AND is_honeypot IS FALSE", batchStatus.Active).
+				Where("EXISTS (SELECT 1 FROM markups m WHERE m.batch_id = batches.id)").
+				Where("NOT EXISTS (SELECT 1 FROM markups m WHERE m.batch_id = batches.id AND m.status_id = ?)", markupStatus.Pending),
+		)
+		tm.transitionBatches(
+			batchStatus.Paused,
+			tm.db.Where("status_id = ? AND ends_at <= ?", batchStatus.Active, now),
+		)
+
+		time.Sleep(time.Minute)
+	}
+}
+
+// transitionBatches moves batches found by query to status on behalf of schedule.
+func (tm *TaskManager) transitionBatches(to uint, query *gorm.DB) {
+	var batches []models.Batch
+	if err := query.Find(&batches).Error; err != nil {
+		tm.log.Error("failed to find batches to transition", slog.Any("error", err))
+		return
+	}
+
+	for _, batch := range batches {
+		err := tm.db.Transaction(func(tx *gorm.DB) error {
+			return lifecycle.Transition(tx, &batch, to, nil)
+		})
+		if err != nil && !errors.Is(err, lifecycle.ErrStatusChanged) {
+			tm.log.Error(
+				"failed to transition batch",
+				slog.Any("batch_id", batch.ID),
+				slog.Any("status_id", to),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// settleEarnings records earnings of assessments whose markups got correct assessment. Assessments are settled
+// after time limit of their editing by assessor has passed.
+func (tm *TaskManager) settleEarnings() {
+	const limit = 500
+
+	for {
+		for {
+			var assessments []models.Assessment
+			err := tm.db.
+				Preload("Markup.Batch").
+				Where("hash IS NOT NULL AND is_prior IS FALSE AND invalidated_at IS NULL").
+				Where("COALESCE(updated_at, created_at) < ?", time.Now().Add(-30*time.Minute)).
+				Where("settled_at IS NULL").
+				Where(
+					"markup_id IN (SELECT m.id FROM markups m JOIN batches b ON b.id = m.batch_id "+
+						"WHERE m.correct_assessment_hash IS NOT NULL AND (m.status_id = ? OR b.is_honeypot IS TRUE))",
+					markupStatus.Processed,
+				).
+				Order("id").
+				Limit(limit).
+				Find(&assessments).Error
+			if err != nil {
+				tm.log.Error("failed to find assessments to settle", slog.Any("error", err))
+				break
+			}
+
+			failed := false
+			for _, assessment := range assessments {
+				// Assessment is loaded again, so that it is settled with its current outcome.
+				err := tm.db.Transaction(func(tx *gorm.DB) error {
+					var current models.Assessment
+					if err := tx.Preload("Markup.Batch").Where("id = ?", assessment.ID).First(&current).Error; err != nil {
+						return err
+					}
+					_, err := ledger.Settle(tx, current)
+					return err
+				})
+				if err != nil {
+					tm.log.Error("failed to settle assessment", slog.Any("assessment_id", assessment.ID), slog.Any("error", err))
+					failed = true
+				}
+			}
+
+			// Failed assessments would be found again, so that they are retried on the next run.
+			if failed || len(assessments) < limit {
+				break
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"os"
+	"time"
 )
 
 var errFileNotExists = errors.New("config file does not exist")
@@ -18,6 +19,8 @@ type Config struct {
 	Port int    `yaml:"port"`
 	DB   DB     `yaml:"db"`
 	JWT  JWT    `yaml:"jwt"`
+	Auth Auth   `yaml:"auth"`
+	Mail Mail   `yaml:"mail"`
 }
 
 // DB represents database configuration.
@@ -29,9 +32,81 @@ type DB struct {
 	Port   int    `yaml:"port"`
 }
 
-// JWT represents database configuration.
+// JWT represents token signing configuration. If Keys are empty, tokens are signed with Secret using HS256.
 type JWT struct {
 	Secret string `yaml:"secret"`
+	// ActiveKey is an id of the key that signs new tokens. Other keys are used only to validate issued tokens.
+	ActiveKey string   `yaml:"active_key"`
+	Keys      []JWTKey `yaml:"keys"`
+}
+
+// JWTKey represents signing key. Algorithm is one of HS256, RS256 and EdDSA.
+// Tokens signed with the key are rejected after ExpiresAt.
+type JWTKey struct {
+	ID             string     `yaml:"id"`
+	Algorithm      string     `yaml:"algorithm"`
+	PrivateKeyPath string     `yaml:"private_key_path"`
+	ExpiresAt      *time.Time `yaml:"expires_at"`
+}
+
+// Auth represents authentication configuration.
+type Auth struct {
+	// InviteOnly forbids to register without invite code.
+	InviteOnly bool       `yaml:"invite_only"`
+	LoginLimit LoginLimit `yaml:"login_limit"`
+	OIDC       OIDC       `yaml:"oidc"`
+	Password   Password   `yaml:"password"`
+}
+
+// Password represents password strength rules and password reset.
+// Reset link is ResetURL with token in "token" query parameter. If ResetURL is empty, token alone is sent.
+type Password struct {
+	MinLength     int           `yaml:"min_length" env-default:"8"`
+	RequireUpper  bool          `yaml:"require_upper"`
+	RequireLower  bool          `yaml:"require_lower"`
+	RequireDigit  bool          `yaml:"require_digit"`
+	RequireSymbol bool          `yaml:"require_symbol"`
+	ResetURL      string        `yaml:"reset_url"`
+	ResetTTL      time.Duration `yaml:"reset_ttl" env-default:"1h"`
+}
+
+// LoginLimit represents throttling of failed sign in attempts.
+// Store is either "memory" for single instance or "postgres" to share state between instances.
+type LoginLimit struct {
+	Store            string        `yaml:"store" env-default:"memory"`
+	IPThreshold      int           `yaml:"ip_threshold" env-default:"20"`
+	AccountThreshold int           `yaml:"account_threshold" env-default:"5"`
+	BaseLockout      time.Duration `yaml:"base_lockout" env-default:"1m"`
+	MaxLockout       time.Duration `yaml:"max_lockout" env-default:"1h"`
+	Window           time.Duration `yaml:"window" env-default:"1h"`
+}
+
+// OIDC represents single sign-on through OpenID Connect provider.
+// Users are created on first sign in with DefaultRole, and GroupRoles maps groups from GroupsClaim to role names.
+// Tokens are passed to FrontendURL in URL fragment, or returned as JSON if FrontendURL is empty.
+// Existing users are linked to identities with the same verified email only if LinkByEmail is set.
+type OIDC struct {
+	Enabled      bool              `yaml:"enabled"`
+	Issuer       string            `yaml:"issuer"`
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	RedirectURL  string            `yaml:"redirect_url"`
+	Scopes       []string          `yaml:"scopes" env-default:"openid,email,profile"`
+	DefaultRole  string            `yaml:"default_role" env-default:"assessor"`
+	GroupsClaim  string            `yaml:"groups_claim" env-default:"groups"`
+	GroupRoles   map[string]string `yaml:"group_roles"`
+	FrontendURL  string            `yaml:"frontend_url"`
+	LinkByEmail  bool              `yaml:"link_by_email"`
+}
+
+// Mail represents outgoing mail configuration. Driver is either "log", which only logs messages, or "smtp".
+type Mail struct {
+	Driver string `yaml:"driver" env-default:"log"`
+	Host   string `yaml:"host"`
+	Port   int    `yaml:"port" env-default:"587"`
+	User   string `yaml:"user"`
+	Pass   string `yaml:"pass"`
+	From   string `yaml:"from"`
 }
 
 // LoadPath loads configuration from specified path and returns config instance and error.
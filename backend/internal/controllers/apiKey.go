@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/token"
+	"net/http"
+	"time"
+)
+
+// apiKeyPrefix marks API keys, so that they can be recognized, e.g. by secret scanners.
+const apiKeyPrefix = "mk_"
+
+type APIKey struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewAPIKey(
+	log *slog.Logger,
+	db *gorm.DB,
+) *APIKey {
+	return &APIKey{
+		log: log,
+		db:  db,
+	}
+}
+
+// Index returns API keys of authenticated user.
+func (con *APIKey) Index(c *gin.Context) {
+	const op = "APIKeyController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var apiKeys []models.APIKey
+	err = con.db.
+		Preload("Permissions").
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&apiKeys).Error
+	if err != nil {
+		log.Error("failed to find api keys", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+type storeAPIKey struct {
+	Name        string     `binding:"required" json:"name"`
+	Permissions []string   `binding:"required,min=1" json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// Store creates API key of authenticated user and returns it. The key is returned only once.
+// Key can be granted only permissions of the user. API keys can not create other keys.
+func (con *APIKey) Store(c *gin.Context) {
+	const op = "APIKeyController.Store"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+	if auth.IsAPIKey(c) {
+		responses.ForbiddenError(c)
+		return
+	}
+
+	var data storeAPIKey
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if data.ExpiresAt != nil && data.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	for _, permission := range data.Permissions {
+		if !user.Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission is not granted: " + permission})
+			return
+		}
+	}
+
+	var permissions []models.Permission
+	if err := con.db.Where("name IN ?", data.Permissions).Find(&permissions).Error; err != nil {
+		log.Error("failed to find permissions", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	secret, err := token.Generate()
+	if err != nil {
+		log.Error("failed to generate api key", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		UserID:      user.ID,
+		Name:        data.Name,
+		Prefix:      key[:len(apiKeyPrefix)+8],
+		KeyHash:     token.Hash(key),
+		ExpiresAt:   data.ExpiresAt,
+		CreatedAt:   time.Now(),
+		Permissions: permissions,
+	}
+	if err := con.db.Create(&apiKey).Error; err != nil {
+		log.Error("failed to create api key", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":  apiKey.ID,
+		"key": key,
+	})
+}
+
+// Destroy revokes API key of authenticated user.
+func (con *APIKey) Destroy(c *gin.Context) {
+	const op = "APIKeyController.Destroy"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := con.db.Where("id = ? AND user_id = ?", id, user.ID).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("api key not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find api key", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		if err := con.db.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			log.Error("failed to revoke api key", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
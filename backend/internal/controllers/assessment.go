@@ -2,15 +2,20 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log/slog"
+	"markup/internal/domain/enums/batchStatus"
 	"markup/internal/domain/enums/markupStatus"
-	"markup/internal/domain/enums/roles"
+	"markup/internal/domain/enums/permissions"
 	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
 	"markup/internal/lib/auth"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/ledger"
 	"markup/internal/lib/responses"
+	assessmentValidation "markup/internal/lib/validation/assessment"
 	"markup/internal/lib/validation/query"
 	"math/rand"
 	"net/http"
@@ -66,7 +71,7 @@ func (con *Assessment) Index(c *gin.Context) {
 	var assessments []models.Assessment
 	var total int64
 
-	tx := con.db.Model(&models.Assessment{})
+	tx := con.db.Model(&models.Assessment{}).Scopes(tenantScope(c, assessmentTenantCondition))
 	if userID > 0 {
 		tx = tx.Where("user_id = ?", userID)
 	}
@@ -78,8 +83,11 @@ func (con *Assessment) Index(c *gin.Context) {
 	tx = con.db.Limit(perPage).
 		Offset(offset).
 		Preload("Fields.MarkupTypeField").
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
 		Preload("User").
-		Preload("Markup.Batch.MarkupTypes.Fields")
+		Preload("Markup.Batch.MarkupTypes.Fields", orderFields).
+		Scopes(tenantScope(c, assessmentTenantCondition))
 	if userID > 0 {
 		tx = tx.Where("user_id = ?", userID)
 	}
@@ -118,8 +126,11 @@ func (con *Assessment) Find(c *gin.Context) {
 
 	var assessment models.Assessment
 	err := con.db.
-		Preload("Fields").
+		Preload("Fields.MarkupTypeField").
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, assessmentTenantCondition)).
 		First(&assessment).Error
 
 	if err != nil {
@@ -143,11 +154,54 @@ type storeAssessment struct {
 }
 
 type storeAssessmentField struct {
-	Text              *string `json:"text"`
-	MarkupTypeFieldID uint    `binding:"required" json:"markup_type_field_id"`
+	Text              *string               `json:"text"`
+	Number            *float64              `json:"number"`
+	NumberTo          *float64              `json:"number_to"`
+	Spans             []storeAssessmentSpan `binding:"dive" json:"spans"`
+	Boxes             []storeAssessmentBox  `binding:"dive" json:"boxes"`
+	MarkupTypeFieldID uint                  `binding:"required" json:"markup_type_field_id"`
+}
+
+type storeAssessmentSpan struct {
+	Column string `binding:"required" json:"column"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+type storeAssessmentBox struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// toModel converts request field to models.AssessmentField without identifiers.
+func (f storeAssessmentField) toModel() models.AssessmentField {
+	field := models.AssessmentField{
+		MarkupTypeFieldID: f.MarkupTypeFieldID,
+		Text:              f.Text,
+		Number:            f.Number,
+		NumberTo:          f.NumberTo,
+	}
+	for _, span := range f.Spans {
+		field.Spans = append(field.Spans, models.AssessmentSpan{
+			Column: span.Column,
+			Start:  span.Start,
+			End:    span.End,
+		})
+	}
+	for _, box := range f.Boxes {
+		field.Boxes = append(field.Boxes, models.AssessmentBox{
+			X:      box.X,
+			Y:      box.Y,
+			Width:  box.Width,
+			Height: box.Height,
+		})
+	}
+	return field
 }
 
-// Store creates models.Assessment for given models.Markup. Is used only by admins.
+// Store creates correct models.Assessment for given models.Markup. Requires permissions.AssessmentCreate.
 // todo: ensure there is only one models.Assessment for models.Markup for every models.Assessment.UserID
 // todo: forbid to create models.Assessment when models.Markup is already processed if models.User is not admin
 func (con *Assessment) Store(c *gin.Context) {
@@ -159,11 +213,6 @@ func (con *Assessment) Store(c *gin.Context) {
 		responses.UnauthorizedError(c)
 		return
 	}
-	var isAdmin = user.HasRole(roles.Admin)
-	if !isAdmin {
-		responses.ForbiddenError(c)
-		return
-	}
 
 	var data storeAssessment
 
@@ -172,6 +221,22 @@ func (con *Assessment) Store(c *gin.Context) {
 		return
 	}
 
+	var markupCount int64
+	err = con.db.Model(&models.Markup{}).
+		Where("id = ?", data.MarkupID).
+		Scopes(tenantScope(c, markupTenantCondition)).
+		Count(&markupCount).Error
+	if err != nil {
+		log.Error("failed to find markup", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if markupCount == 0 {
+		log.Warn("markup not found", slog.Any("markup_id", data.MarkupID))
+		responses.NotFoundError(c)
+		return
+	}
+
 	assessment := models.Assessment{
 		CreatedAt: time.Now(),
 		UserID:    user.ID,
@@ -181,10 +246,11 @@ func (con *Assessment) Store(c *gin.Context) {
 
 	assessment.Fields = make([]models.AssessmentField, len(data.Fields))
 	for i, field := range data.Fields {
-		assessment.Fields[i] = models.AssessmentField{
-			MarkupTypeFieldID: field.MarkupTypeFieldID,
-			Text:              field.Text,
-		}
+		assessment.Fields[i] = field.toModel()
+	}
+
+	if !con.validateFields(c, log, assessment) {
+		return
 	}
 
 	hash := assessment.CalculateHash()
@@ -197,6 +263,14 @@ func (con *Assessment) Store(c *gin.Context) {
 		return
 	}
 
+	before, err := correctAssessmentSnapshot(tx, assessment.MarkupID)
+	if err != nil {
+		tx.Rollback()
+		log.Error("failed to find correct assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	// Delete admin assessment.
 	if err := tx.
 		Where("markup_id = ? AND is_prior IS TRUE", assessment.MarkupID).
@@ -204,6 +278,7 @@ func (con *Assessment) Store(c *gin.Context) {
 		tx.Rollback()
 		log.Error("failed to delete other admins' assessments", slog.Any("error", err))
 		responses.InternalServerError(c)
+		return
 	}
 
 	// Save assessment.
@@ -213,10 +288,32 @@ func (con *Assessment) Store(c *gin.Context) {
 		responses.InternalServerError(c)
 		return
 	}
+	if err := addRevision(tx, assessment, user.ID, nil); err != nil {
+		tx.Rollback()
+		log.Error("failed to save revision", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if _, err := consensus.Recalculate(tx, assessment.MarkupID); err != nil {
+		tx.Rollback()
+		log.Error("failed to recalculate consensus", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
 
-	if err := updateCorrectAssessment(log, tx, assessment, true); err != nil {
+	after, err := correctAssessmentSnapshot(tx, assessment.MarkupID)
+	if err != nil {
 		tx.Rollback()
+		log.Error("failed to find correct assessment", slog.Any("error", err))
 		responses.InternalServerError(c)
+		return
+	}
+	if err := audit.Record(c, tx, audit.SetCorrect, audit.Markup, assessment.MarkupID, before, after); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -230,7 +327,22 @@ func (con *Assessment) Store(c *gin.Context) {
 	})
 }
 
+// batchAccessScope limits batches, aliased as alias, to batches that user is granted access to, e.g. by invite.
+// Users without granted batches may assess any batch. Honeypots are available to everyone.
+func batchAccessScope(alias string, userID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"("+alias+".is_honeypot IS TRUE OR "+
+				"NOT EXISTS (SELECT 1 FROM user_batches ub WHERE ub.user_id = ?) OR "+
+				alias+".id IN (SELECT ub.batch_id FROM user_batches ub WHERE ub.user_id = ?))",
+			userID, userID,
+		)
+	}
+}
+
 // Next selects available markup and creates empty models.Assessment for it.
+// Unfinished assessments of disabled users do not hold markups. Users that are granted access to batches
+// receive markups of these batches only, see batchAccessScope.
 func (con *Assessment) Next(c *gin.Context) {
 	const op = "AssessmentController.Next"
 	log := con.log.With(slog.String("op", op))
@@ -240,16 +352,13 @@ func (con *Assessment) Next(c *gin.Context) {
 		responses.UnauthorizedError(c)
 		return
 	}
-	var isAssessor = user.HasRole(roles.Assessor)
-	if !isAssessor {
-		responses.ForbiddenError(c)
-		return
-	}
 
 	log.Info("searching for pending assesment")
 	var pendingAssessment models.Assessment
 	err = con.db.Model(models.Assessment{}).
+		Preload("Markup.Batch.MarkupTypes.Fields", orderFields).
 		Preload("Markup.Batch.MarkupTypes.Fields.AssessmentType").
+		Preload("Markup.Batch.MarkupTypes.Examples.Markup").
 		Where("hash IS NULL and user_id = ?", user.ID).
 		First(&pendingAssessment).Error
 
@@ -260,10 +369,31 @@ func (con *Assessment) Next(c *gin.Context) {
 	}
 	if err == nil {
 		log.Info("pending assesment found", slog.Any("assessment_id", pendingAssessment.ID))
-		c.JSON(http.StatusOK, formatNextResponse(pendingAssessment))
+		response, err := formatNextResponse(con.db, pendingAssessment)
+		if err != nil {
+			log.Error("failed to find example answers", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
+	now := time.Now()
+	// available finds pending markups of active batches that can be given to user.
+	available := func(db *gorm.DB) *gorm.DB {
+		return db.
+			Table("markups m").
+			Joins("JOIN batches b ON m.batch_id = b.id").
+			Joins("LEFT JOIN assessments a ON a.markup_id = m.id").
+			Where("m.status_id = ? and b.status_id = ?", markupStatus.Pending, batchStatus.Active).
+			Scopes(batchDeadlineScope("b", now), batchAccessScope("b", user.ID)).
+			Group("m.id, b.overlaps, b.priority").
+			//Having("COUNT(a.id) < b.overlaps").
+			Having("NOT EXISTS (SELECT 1 FROM assessments a3 JOIN users u ON u.id = a3.user_id WHERE a3.markup_id = m.id AND a3.hash IS NULL AND u.is_disabled IS FALSE)").
+			Having("NOT EXISTS (SELECT 1 FROM assessments a2 WHERE a2.markup_id = m.id AND a2.user_id = ?)", user.ID)
+	}
+
 	log.Info("fetching priorities")
 	var priorities []int
 	//err = con.db.
@@ -274,15 +404,8 @@ func (con *Assessment) Next(c *gin.Context) {
 	//	Distinct("priority").
 	//	Pluck("priority", &priorities).Error
 	err = con.db.
-		Table("markups m").
+		Scopes(available, batchQuotaScope("b", user.ID, now)).
 		Select("b.priority priority,a.id, m.id, b.overlaps").
-		Joins("JOIN batches b ON m.batch_id = b.id").
-		Joins("LEFT JOIN assessments a ON a.markup_id = m.id").
-		Where("m.status_id = ? and b.is_active IS TRUE", markupStatus.Pending).
-		Group("m.id, b.overlaps, b.priority").
-		//Having("COUNT(a.id) < b.overlaps").
-		Having("NOT EXISTS (SELECT 1 FROM assessments a3 WHERE a3.markup_id = m.id AND a3.hash IS NULL)").
-		Having("NOT EXISTS (SELECT 1 FROM assessments a2 WHERE a2.markup_id = m.id AND a2.user_id = ?)", user.ID).
 		Distinct("priority").
 		Pluck("priority", &priorities).Error
 
@@ -292,6 +415,24 @@ func (con *Assessment) Next(c *gin.Context) {
 		return
 	}
 	if len(priorities) == 0 {
+		// Tell apart batches that are out of quota from absence of markups.
+		var limited []uint
+		err := con.db.
+			Scopes(available).
+			Select("m.id").
+			Limit(1).
+			Pluck("m.id", &limited).Error
+		if err != nil {
+			log.Error("unable to fetch quota limited markups", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if len(limited) > 0 {
+			log.Warn("quota exhausted")
+			responses.QuotaExhaustedError(c)
+			return
+		}
+
 		log.Error("failed to find markup", slog.Any("error", err))
 		responses.NotFoundError(c)
 		return
@@ -302,17 +443,23 @@ func (con *Assessment) Next(c *gin.Context) {
 
 	var res struct {
 		MarkupID         uint `gorm:"column:id"`
+		BatchID          uint
 		AssessmentsCount int64
 	}
 	err = con.db.
 		Table("markups").
-		Select("markups.id, COUNT(assessments.id), batches.overlaps, markups.status_id").
+		Select("markups.id, markups.batch_id, COUNT(assessments.id), batches.overlaps, markups.status_id").
 		Joins("JOIN batches ON markups.batch_id = batches.id").
 		Joins("LEFT JOIN assessments ON assessments.markup_id = markups.id").
-		Where("status_id = ? and batches.priority = ? and batches.is_active IS TRUE", markupStatus.Pending, priority).
-		Group("markups.id, markups.status_id, batches.overlaps").
+		Where("markups.status_id = ? and batches.priority = ? and batches.status_id = ?", markupStatus.Pending, priority, batchStatus.Active).
+		Scopes(
+			batchDeadlineScope("batches", now),
+			batchQuotaScope("batches", user.ID, now),
+			batchAccessScope("batches", user.ID),
+		).
+		Group("markups.id, markups.batch_id, markups.status_id, batches.overlaps").
 		//Having("COUNT(assessments.id) < batches.overlaps").
-		Having("NOT EXISTS (SELECT 1 FROM assessments a3 WHERE a3.markup_id = markups.id AND a3.hash IS NULL)").
+		Having("NOT EXISTS (SELECT 1 FROM assessments a3 JOIN users u ON u.id = a3.user_id WHERE a3.markup_id = markups.id AND a3.hash IS NULL AND u.is_disabled IS FALSE)").
 		Having("NOT EXISTS (SELECT 1 FROM assessments a WHERE a.markup_id = markups.id AND a.user_id = ?)", user.ID).
 		First(&res).Error
 
@@ -336,16 +483,52 @@ func (con *Assessment) Next(c *gin.Context) {
 		Hash:      nil,
 	}
 
-	// Save assessment.
-	if err := con.db.Create(&assessment).Error; err != nil {
+	// Save assessment. Batch is locked, so that concurrent requests do not exceed its limits.
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		var batch models.Batch
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", res.BatchID).
+			First(&batch).Error
+		if err != nil {
+			return err
+		}
+
+		quota, err := getBatchQuota(tx, batch, user.ID, now)
+		if err != nil {
+			return err
+		}
+		if quota.exhausted() {
+			return errQuotaExhausted
+		}
+
+		return tx.Create(&assessment).Error
+	})
+	if err != nil {
+		if errors.Is(err, errQuotaExhausted) {
+			log.Warn("quota exhausted", slog.Any("batch_id", res.BatchID))
+			responses.QuotaExhaustedError(c)
+			return
+		}
+
 		log.Error("failed to create assessment", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
-	con.db.Preload("Markup.Batch.MarkupTypes.Fields.AssessmentType").First(&assessment)
+	con.db.
+		Preload("Markup.Batch.MarkupTypes.Fields", orderFields).
+		Preload("Markup.Batch.MarkupTypes.Fields.AssessmentType").
+		Preload("Markup.Batch.MarkupTypes.Examples.Markup").
+		First(&assessment)
 
-	c.JSON(http.StatusCreated, formatNextResponse(assessment))
+	response, err := formatNextResponse(con.db, assessment)
+	if err != nil {
+		log.Error("failed to find example answers", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 func weightedRandomChoice(priorities []int) int {
@@ -370,7 +553,15 @@ func weightedRandomChoice(priorities []int) int {
 	return priorities[0] // Fallback (should never reach here)
 }
 
-func formatNextResponse(assessment models.Assessment) *gin.H {
+// nextExample is a worked example of models.MarkupType along with the answer that makes it positive or negative.
+type nextExample struct {
+	models.MarkupTypeExample
+	Answer []storeAssessmentField `json:"answer"`
+}
+
+// formatNextResponse returns markup data and current models.MarkupType of its batch
+// along with instructions, field help texts and worked examples.
+func formatNextResponse(db *gorm.DB, assessment models.Assessment) (*gin.H, error) {
 	var markupType models.MarkupType
 	for _, mt := range assessment.Markup.Batch.MarkupTypes {
 		if mt.ChildID == nil {
@@ -378,55 +569,51 @@ func formatNextResponse(assessment models.Assessment) *gin.H {
 		}
 	}
 
+	examples := make([]nextExample, len(markupType.Examples))
+	for i, example := range markupType.Examples {
+		answer, err := exampleAnswer(db, example.Markup)
+		if err != nil {
+			return nil, err
+		}
+		examples[i] = nextExample{MarkupTypeExample: example, Answer: answer}
+	}
+
 	return &gin.H{
 		"assessment_id": assessment.ID,
 		"markup_type":   markupType,
+		"instructions":  markupType.Instructions,
+		"examples":      examples,
 		"data":          assessment.Markup.Data,
-	}
+	}, nil
 }
 
-// updateCorrectAssessment checks whether there is enough identical assessments or an models.Assessment is made by admin
-// to mark models.Markup as markupStatus.Processed and set models.Markup.CorrectAssessmentHash.
-func updateCorrectAssessment(
-	log *slog.Logger,
-	tx *gorm.DB,
-	assessment models.Assessment,
-	isAdmin bool,
-) error {
-	const op = "Assessment.UpdateCorrectAssessment"
-	log = log.With(slog.String("op", op))
-
-	isCorrectAssessment := false
-	if isAdmin {
-		isCorrectAssessment = true
+// exampleAnswer returns correct answer to example markup in the format it is submitted in: fields of its prior
+// assessment or else of assessment that matches its correct assessment hash. Returns nil if markup has no answer.
+func exampleAnswer(db *gorm.DB, markup models.Markup) ([]storeAssessmentField, error) {
+	query := db.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Where("markup_id = ? AND hash IS NOT NULL AND invalidated_at IS NULL", markup.ID)
+	if markup.CorrectAssessmentHash != nil {
+		query = query.Where("is_prior IS TRUE OR hash = ?", *markup.CorrectAssessmentHash)
 	} else {
-		// Check if enough assessments are made.
-		tx.Preload("Markup.Batch").First(&assessment)
-		var count int64
-		tx.Model(&Assessment{}).
-			Where("hash = ? AND markup_id = ?", assessment.Hash, assessment.MarkupID).
-			Count(&count)
-
-		if count >= int64(assessment.Markup.Batch.Overlaps) {
-			isCorrectAssessment = true
-		}
+		query = query.Where("is_prior IS TRUE")
 	}
 
-	if isCorrectAssessment {
-		// Mark Markup as processed.
-		tx.Model(&Markup{}).
-			Where("id = ?", assessment.MarkupID).
-			Updates(map[string]interface{}{
-				"status_id":               markupStatus.Processed,
-				"correct_assessment_hash": assessment.Hash,
-			})
-		if err := tx.Error; err != nil {
-			log.Error("failed to update markup", slog.Any("error", err))
-			return fmt.Errorf("%s: %w", op, err)
-		}
+	var assessment models.Assessment
+	err := query.Order("is_prior DESC, id").First(&assessment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	answer := make([]storeAssessmentField, len(assessment.Fields))
+	for i, field := range assessment.Fields {
+		answer[i] = fromModel(field)
+	}
+	return answer, nil
 }
 
 type updateAssessment struct {
@@ -436,9 +623,8 @@ type updateAssessment struct {
 	} `binding:"required,dive" json:"fields"`
 }
 
-// todo: can steal another assessment fields if their ids are passed in storeAssessmentField.
-// todo: check if specified AssessmentField ids belong to respective Assessment.
-// todo: same in MarkupType.Update.
+// Update replaces models.AssessmentField of models.Assessment with submitted ones.
+// Submitted fields are validated against active models.MarkupType of respective models.Batch.
 func (con *Assessment) Update(c *gin.Context) {
 	const op = "AssessmentController.Update"
 	id := c.Param("id")
@@ -452,10 +638,19 @@ func (con *Assessment) Update(c *gin.Context) {
 		return
 	}
 
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+	var isAdmin = user.Can(permissions.AssessmentManage)
+
+	// Only own assessments can be updated, assessments of other users are not found.
 	var assessment models.Assessment
-	err := con.db.
-		Preload("Fields").
-		Where("id = ?", id).
+	err = con.db.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Where("id = ? AND user_id = ?", id, user.ID).
 		First(&assessment).Error
 
 	if err != nil {
@@ -470,27 +665,35 @@ func (con *Assessment) Update(c *gin.Context) {
 		return
 	}
 
-	user, err := auth.User(c)
-	if err != nil {
-		responses.UnauthorizedError(c)
-		return
-	}
-	var isAdmin = user.HasRole(roles.Admin)
-
-	if user.ID != assessment.UserID {
+	if assessment.InvalidatedAt != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "cannot update assessment of another user",
+			"error": "cannot update invalidated assessment",
 		})
 		return
 	}
 
-	if !isAdmin && assessment.UpdatedAt.Add(30*time.Minute).Before(time.Now()) {
+	changedAt := assessment.CreatedAt
+	if assessment.UpdatedAt != nil {
+		changedAt = *assessment.UpdatedAt
+	}
+	if !isAdmin && changedAt.Add(30*time.Minute).Before(time.Now()) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "cannot update assessment if > 30 minutes have passed",
 		})
 		return
 	}
 
+	before := assessment
+	fields := make([]models.AssessmentField, len(data.Fields))
+	for i, field := range data.Fields {
+		fields[i] = field.toModel()
+	}
+	assessment.Fields = fields
+
+	if !con.validateFields(c, log, assessment) {
+		return
+	}
+
 	tx := con.db.Begin()
 	if err := tx.Error; err != nil {
 		log.Error("failed to begin transaction", slog.Any("error", err))
@@ -498,6 +701,14 @@ func (con *Assessment) Update(c *gin.Context) {
 		return
 	}
 
+	// Assessments made before revisions were kept get their current state as the first revision.
+	if err := ensureRevision(tx, before); err != nil {
+		tx.Rollback()
+		log.Error("failed to save current revision", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	result := tx.Where("assessment_id = ?", assessment.ID).Delete(&models.AssessmentField{})
 	if err := result.Error; err != nil {
 		tx.Rollback()
@@ -506,14 +717,6 @@ func (con *Assessment) Update(c *gin.Context) {
 		return
 	}
 
-	assessment.Fields = make([]models.AssessmentField, len(data.Fields))
-	for i, field := range data.Fields {
-		assessment.Fields[i] = models.AssessmentField{
-			Text:              field.Text,
-			MarkupTypeFieldID: field.MarkupTypeFieldID,
-		}
-	}
-
 	hash := assessment.CalculateHash()
 	assessment.Hash = &hash
 
@@ -524,9 +727,25 @@ func (con *Assessment) Update(c *gin.Context) {
 		return
 	}
 
-	if err := updateCorrectAssessment(log, tx, assessment, isAdmin); err != nil {
+	if err := addRevision(tx, assessment, user.ID, nil); err != nil {
 		tx.Rollback()
+		log.Error("failed to save revision", slog.Any("error", err))
 		responses.InternalServerError(c)
+		return
+	}
+
+	if _, err := consensus.Recalculate(tx, assessment.MarkupID); err != nil {
+		tx.Rollback()
+		log.Error("failed to recalculate consensus", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := audit.Record(c, tx, audit.Update, audit.Assessment, assessment.ID, before, assessment); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -538,13 +757,154 @@ func (con *Assessment) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
+// validateFields checks models.Assessment fields against active models.MarkupType of respective models.Markup
+// and sends response if validation fails.
+func (con *Assessment) validateFields(c *gin.Context, log *slog.Logger, assessment models.Assessment) bool {
+	var markup models.Markup
+	if err := con.db.Where("id = ?", assessment.MarkupID).First(&markup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("markup not found", slog.Any("markup_id", assessment.MarkupID))
+			responses.NotFoundError(c)
+			return false
+		}
+
+		log.Error("failed to find markup", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+
+	markupType, err := findActiveMarkupType(con.db, assessment.MarkupID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("markup type not found", slog.Any("markup_id", assessment.MarkupID))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "markup has no markup type"})
+			return false
+		}
+
+		log.Error("failed to find markup type", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+
+	if err := assessmentValidation.Validate(markupType, markup.Data, assessment.Fields); err != nil {
+		log.Warn("invalid assessment fields", slog.Any("error", err))
+		responses.ValidationError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// correctAssessment is a snapshot of correct assessment of models.Markup that is recorded to audit log.
+type correctAssessment struct {
+	CorrectAssessmentHash *string            `json:"correct_assessment_hash"`
+	PriorAssessment       *models.Assessment `json:"prior_assessment"`
+}
+
+// correctAssessmentSnapshot returns correct assessment hash and prior assessment of models.Markup.
+func correctAssessmentSnapshot(tx *gorm.DB, markupID uint) (correctAssessment, error) {
+	var res correctAssessment
+
+	var markup models.Markup
+	if err := tx.Where("id = ?", markupID).First(&markup).Error; err != nil {
+		return res, err
+	}
+	res.CorrectAssessmentHash = markup.CorrectAssessmentHash
+
+	var prior models.Assessment
+	err := tx.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Where("markup_id = ? AND is_prior IS TRUE", markupID).
+		First(&prior).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return res, nil
+		}
+		return res, err
+	}
+	res.PriorAssessment = &prior
+
+	return res, nil
+}
+
+// findActiveMarkupType returns latest models.MarkupType of models.Batch that models.Markup belongs to.
+func findActiveMarkupType(db *gorm.DB, markupID uint) (models.MarkupType, error) {
+	var markupType models.MarkupType
+	err := db.
+		Preload("Fields").
+		Joins("JOIN markups m ON m.batch_id = markup_types.batch_id").
+		Where("m.id = ? AND markup_types.child_id IS NULL", markupID).
+		First(&markupType).Error
+
+	return markupType, err
+}
+
+// Destroy deletes models.Assessment and recalculates consensus of its models.Markup, so that markup returns
+// to pending if remaining assessments no longer agree. Users with permissions.AssessmentManage can delete any
+// assessment, other users with permissions.AssessmentDelete can delete only own assessments within 30 minutes
+// after the last update.
 func (con *Assessment) Destroy(c *gin.Context) {
 	const op = "AssessmentController.Destroy"
 	id := c.Param("id")
 
 	log := con.log.With(slog.String("op", op), slog.String("id", id))
 
-	log.Info("AssessmentController.Destroy")
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var assessment models.Assessment
+	err = con.db.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Where("id = ?", id).
+		Scopes(assessmentAccessScope(c, user, permissions.AssessmentManage)).
+		First(&assessment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("assessment not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if !user.Can(permissions.AssessmentManage) {
+		changedAt := assessment.CreatedAt
+		if assessment.UpdatedAt != nil {
+			changedAt = *assessment.UpdatedAt
+		}
+		if changedAt.Add(30 * time.Minute).Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "cannot delete assessment if > 30 minutes have passed",
+			})
+			return
+		}
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := ledger.Reverse(tx, assessment.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Assessment{}, assessment.ID).Error; err != nil {
+			return err
+		}
+		if _, err := consensus.Recalculate(tx, assessment.MarkupID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Delete, audit.Assessment, assessment.ID, assessment, nil)
+	})
+	if err != nil {
+		log.Error("failed to delete assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
 
-	c.JSON(http.StatusNotImplemented, nil)
+	c.JSON(http.StatusOK, "OK")
 }
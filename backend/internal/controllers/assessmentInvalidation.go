@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/enums/jobStatus"
+	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/responses"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type storeAssessmentInvalidation struct {
+	From     *time.Time `json:"from"`
+	To       *time.Time `json:"to"`
+	BatchIDs []uint     `json:"batch_ids"`
+}
+
+// InvalidateAssessments creates a background job that invalidates finished assessments of user, optionally
+// made within [from, to) or in given batches. Invalidated assessments are excluded from consensus and statistics.
+// Progress and summary of the job are available in Invalidations.
+func (con *User) InvalidateAssessments(c *gin.Context) {
+	const op = "UserController.InvalidateAssessments"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	current, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var data storeAssessmentInvalidation
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if data.From != nil && data.To != nil && !data.From.Before(*data.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	var batches []models.Batch
+	if len(data.BatchIDs) > 0 {
+		ids := slices.Clone(data.BatchIDs)
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+
+		err := con.db.
+			Where("id IN ?", ids).
+			Scopes(tenantScope(c, batchTenantCondition)).
+			Find(&batches).Error
+		if err != nil {
+			log.Error("failed to find batches", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if len(batches) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown batch"})
+			return
+		}
+	}
+
+	invalidation := models.AssessmentInvalidation{
+		UserID:      user.ID,
+		CreatedByID: current.ID,
+		From:        data.From,
+		To:          data.To,
+		StatusID:    jobStatus.Pending,
+		CreatedAt:   time.Now(),
+		Batches:     batches,
+	}
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invalidation).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Invalidate, audit.AssessmentInvalidation, invalidation.ID, nil, invalidation)
+	})
+	if err != nil {
+		log.Error("failed to create assessment invalidation", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, invalidation)
+}
+
+// Invalidations returns assessment invalidation jobs of user from the latest one, with their summaries.
+func (con *User) Invalidations(c *gin.Context) {
+	const op = "UserController.Invalidations"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	var invalidations []models.AssessmentInvalidation
+	err := con.db.
+		Preload("Batches").
+		Where("user_id = ?", user.ID).
+		Order("id DESC").
+		Find(&invalidations).Error
+	if err != nil {
+		log.Error("failed to find assessment invalidations", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, invalidations)
+}
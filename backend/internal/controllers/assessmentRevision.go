@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/responses"
+	"net/http"
+	"time"
+)
+
+// assessmentAccessScope limits assessments to assessments of organization if user is granted permission,
+// and to own assessments of user otherwise.
+func assessmentAccessScope(c *gin.Context, user models.User, permission string) func(db *gorm.DB) *gorm.DB {
+	if user.Can(permission) {
+		return tenantScope(c, assessmentTenantCondition)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", user.ID)
+	}
+}
+
+// Revisions returns all revisions of models.Assessment from first to last. Users without
+// permissions.AssessmentRead can list revisions of own assessments only.
+func (con *Assessment) Revisions(c *gin.Context) {
+	const op = "AssessmentController.Revisions"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var assessment models.Assessment
+	err = con.db.
+		Where("id = ?", id).
+		Scopes(assessmentAccessScope(c, user, permissions.AssessmentRead)).
+		First(&assessment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("assessment not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var revisions []models.AssessmentRevision
+	err = con.db.
+		Where("assessment_id = ?", assessment.ID).
+		Order("number").
+		Find(&revisions).Error
+	if err != nil {
+		log.Error("failed to find revisions", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RestoreRevision makes fields of given revision current fields of models.Assessment and records it as a new revision.
+// Users without permissions.AssessmentManage can restore own assessments within the same time limit
+// as they can update them.
+// Consensus of models.Markup is recalculated, since restored answer may differ from the current one.
+func (con *Assessment) RestoreRevision(c *gin.Context) {
+	const op = "AssessmentController.RestoreRevision"
+	id := c.Param("id")
+	number := c.Param("revision")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id), slog.String("revision", number))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var assessment models.Assessment
+	err = con.db.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Where("id = ?", id).
+		Scopes(assessmentAccessScope(c, user, permissions.AssessmentManage)).
+		First(&assessment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("assessment not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if assessment.InvalidatedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cannot restore invalidated assessment",
+		})
+		return
+	}
+
+	if !user.Can(permissions.AssessmentManage) {
+		changedAt := assessment.CreatedAt
+		if assessment.UpdatedAt != nil {
+			changedAt = *assessment.UpdatedAt
+		}
+		if changedAt.Add(30 * time.Minute).Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "cannot restore assessment if > 30 minutes have passed",
+			})
+			return
+		}
+	}
+
+	var revision models.AssessmentRevision
+	err = con.db.
+		Where("assessment_id = ? AND number = ?", assessment.ID, number).
+		First(&revision).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("revision not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find revision", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var revisionFields []storeAssessmentField
+	if err := json.Unmarshal([]byte(revision.Fields), &revisionFields); err != nil {
+		log.Error("failed to decode revision fields", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	before := assessment
+	fields := make([]models.AssessmentField, len(revisionFields))
+	for i, field := range revisionFields {
+		fields[i] = field.toModel()
+	}
+	assessment.Fields = fields
+
+	// Fields of revisions made before markup type of the batch was changed may be invalid now.
+	if !con.validateFields(c, log, assessment) {
+		return
+	}
+
+	tx := con.db.Begin()
+	if err := tx.Error; err != nil {
+		log.Error("failed to begin transaction", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := ensureRevision(tx, before); err != nil {
+		tx.Rollback()
+		log.Error("failed to save current revision", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := tx.Where("assessment_id = ?", assessment.ID).Delete(&models.AssessmentField{}).Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to delete assessment fields", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	hash := assessment.CalculateHash()
+	assessment.Hash = &hash
+
+	if err := tx.Save(&assessment).Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to update assessment", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := addRevision(tx, assessment, user.ID, &revision.ID); err != nil {
+		tx.Rollback()
+		log.Error("failed to save revision", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if _, err := consensus.Recalculate(tx, assessment.MarkupID); err != nil {
+		tx.Rollback()
+		log.Error("failed to recalculate consensus", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := audit.Record(c, tx, audit.Restore, audit.Assessment, assessment.ID, before, assessment); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Error("failed to commit transaction", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// fromModel converts models.AssessmentField to the format it is submitted in.
+func fromModel(field models.AssessmentField) storeAssessmentField {
+	res := storeAssessmentField{
+		MarkupTypeFieldID: field.MarkupTypeFieldID,
+		Text:              field.Text,
+		Number:            field.Number,
+		NumberTo:          field.NumberTo,
+	}
+	for _, span := range field.Spans {
+		res.Spans = append(res.Spans, storeAssessmentSpan{
+			Column: span.Column,
+			Start:  span.Start,
+			End:    span.End,
+		})
+	}
+	for _, box := range field.Boxes {
+		res.Boxes = append(res.Boxes, storeAssessmentBox{
+			X:      box.X,
+			Y:      box.Y,
+			Width:  box.Width,
+			Height: box.Height,
+		})
+	}
+	return res
+}
+
+// addRevision records current state of models.Assessment as its next revision made by userID.
+// Fields must be loaded with spans and boxes.
+func addRevision(tx *gorm.DB, assessment models.Assessment, userID uint, restoredFromID *uint) error {
+	const op = "Assessment.addRevision"
+
+	fields := make([]storeAssessmentField, len(assessment.Fields))
+	for i, field := range assessment.Fields {
+		fields[i] = fromModel(field)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var last int
+	err = tx.Model(&models.AssessmentRevision{}).
+		Select("COALESCE(MAX(number), 0)").
+		Where("assessment_id = ?", assessment.ID).
+		Scan(&last).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	revision := models.AssessmentRevision{
+		AssessmentID:   assessment.ID,
+		Number:         last + 1,
+		UserID:         userID,
+		Hash:           assessment.Hash,
+		Fields:         models.JSON(data),
+		RestoredFromID: restoredFromID,
+		CreatedAt:      time.Now(),
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ensureRevision records current state of finished models.Assessment as its first revision if it has none,
+// so that assessments made before revisions were kept can be restored too.
+func ensureRevision(tx *gorm.DB, assessment models.Assessment) error {
+	const op = "Assessment.ensureRevision"
+
+	if assessment.Hash == nil {
+		return nil
+	}
+
+	var count int64
+	err := tx.Model(&models.AssessmentRevision{}).
+		Where("assessment_id = ?", assessment.ID).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if err := addRevision(tx, assessment, assessment.UserID, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"fmt"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAssessmentRevisionsOfOwner(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	assessor := newTestUser(t, db, "assessor@example.com", &fixture.OrganizationID, permissions.AssessmentAssess)
+
+	own := models.Assessment{
+		MarkupID:  fixture.Markup.ID,
+		UserID:    assessor.ID,
+		CreatedAt: time.Now(),
+		Fields:    []models.AssessmentField{{MarkupTypeFieldID: fixture.MarkupType.Fields[0].ID}},
+	}
+	hash := own.CalculateHash()
+	own.Hash = &hash
+	mustCreate(t, db, &own)
+
+	r := newTestRouter(db, assessor)
+
+	w := serve(r, http.MethodGet, fmt.Sprintf("/assessments/%d/revisions", own.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Assessment of another assessor of the same organization is not accessible.
+	w = serve(r, http.MethodGet, fmt.Sprintf("/assessments/%d/revisions", fixture.Assessment.ID), nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/enums/ledgerEntryType"
+	"markup/internal/domain/enums/markupStatus"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/models"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/ledger"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAssessmentDestroyOfOwner(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	assessor := newTestUser(
+		t, db, "assessor@example.com", &fixture.OrganizationID,
+		permissions.AssessmentAssess, permissions.AssessmentDelete,
+	)
+
+	own := models.Assessment{
+		MarkupID:  fixture.Markup.ID,
+		UserID:    assessor.ID,
+		CreatedAt: time.Now(),
+		Fields:    []models.AssessmentField{{MarkupTypeFieldID: fixture.MarkupType.Fields[0].ID}},
+	}
+	hash := own.CalculateHash()
+	own.Hash = &hash
+	mustCreate(t, db, &own)
+
+	r := newTestRouter(db, assessor)
+
+	// Assessment of another assessor of the same organization is not found.
+	w := serve(r, http.MethodDelete, fmt.Sprintf("/assessments/%d", fixture.Assessment.ID), nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+
+	w = serve(r, http.MethodDelete, fmt.Sprintf("/assessments/%d", own.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.Assessment{}).Where("id IN ?", []uint{own.ID, fixture.Assessment.ID}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected only own assessment to be deleted, %d left", count)
+	}
+}
+
+func TestAssessmentDestroyResettlesEarnings(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	manager := newTestUser(
+		t, db, "manager@example.com", &fixture.OrganizationID,
+		permissions.AssessmentDelete, permissions.AssessmentManage,
+	)
+	assessor := newTestUser(t, db, "assessor@example.com", &fixture.OrganizationID, permissions.AssessmentAssess)
+
+	db.Model(&fixture.Batch).Updates(models.Batch{Price: 100, RejectionPenalty: 30})
+	db.Model(&fixture.Assessment).Update("is_prior", false)
+
+	// Assessment of fixture is correct as the first of equally common answers, the other one is rejected.
+	rejected := models.Assessment{MarkupID: fixture.Markup.ID, UserID: assessor.ID, CreatedAt: time.Now()}
+	hash := rejected.CalculateHash()
+	rejected.Hash = &hash
+	mustCreate(t, db, &rejected)
+
+	if _, err := consensus.Recalculate(db, fixture.Markup.ID); err != nil {
+		t.Fatalf("failed to recalculate consensus: %v", err)
+	}
+	for _, id := range []uint{fixture.Assessment.ID, rejected.ID} {
+		var assessment models.Assessment
+		db.Preload("Markup.Batch").First(&assessment, id)
+		if ok, err := ledger.Settle(db, assessment); !ok || err != nil {
+			t.Fatalf("failed to settle assessment %d: %v", id, err)
+		}
+	}
+
+	// Settled assessment is not settled again.
+	var settled models.Assessment
+	db.Preload("Markup.Batch").First(&settled, rejected.ID)
+	if ok, err := ledger.Settle(db, settled); ok || err != nil {
+		t.Fatalf("expected settled assessment to be left as is, got %v: %v", ok, err)
+	}
+
+	w := serve(newTestRouter(db, manager), http.MethodDelete, fmt.Sprintf("/assessments/%d", fixture.Assessment.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var markup models.Markup
+	db.First(&markup, fixture.Markup.ID)
+	if markup.StatusID != markupStatus.Processed || *markup.CorrectAssessmentHash != hash {
+		t.Fatalf("expected remaining assessment to be correct, got %+v", markup)
+	}
+
+	var entries []models.LedgerEntry
+	db.Where("assessment_id = ?", rejected.ID).Order("id").Find(&entries)
+	expected := []struct {
+		typeID uint
+		amount int64
+	}{
+		{ledgerEntryType.Penalty, -30},
+		{ledgerEntryType.Reversal, 30},
+		{ledgerEntryType.Credit, 100},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+	}
+	for i, entry := range entries {
+		if entry.TypeID != expected[i].typeID || entry.Amount != expected[i].amount {
+			t.Fatalf("unexpected entry %d: %+v", i, entry)
+		}
+	}
+
+	var total int64
+	db.Model(&models.LedgerEntry{}).Where("assessment_id = ?", fixture.Assessment.ID).Select("SUM(amount)").Scan(&total)
+	if total != 0 {
+		t.Fatalf("expected earnings of deleted assessment to be reversed, got %d", total)
+	}
+}
+
+func TestAssessmentStoreOverridesSettledGold(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	admin := newTestUser(
+		t, db, "admin@example.com", &fixture.OrganizationID,
+		permissions.AssessmentCreate, permissions.AssessmentManage,
+	)
+	assessor := newTestUser(t, db, "assessor@example.com", &fixture.OrganizationID, permissions.AssessmentAssess)
+
+	db.Model(&fixture.Batch).Updates(models.Batch{Price: 100, RejectionPenalty: 30})
+	label := "No"
+	no := models.MarkupTypeField{
+		MarkupTypeID:     fixture.MarkupType.ID,
+		AssessmentTypeID: assessmentType.Radio,
+		Name:             &label,
+		Label:            &label,
+		GroupID:          1,
+		GroupKey:         "answer",
+		Key:              "no",
+	}
+	mustCreate(t, db, &no)
+
+	// Assessment matches prior assessment of fixture and is credited.
+	assessment := models.Assessment{
+		MarkupID:  fixture.Markup.ID,
+		UserID:    assessor.ID,
+		CreatedAt: time.Now(),
+		Fields:    []models.AssessmentField{{MarkupTypeFieldID: fixture.MarkupType.Fields[0].ID}},
+	}
+	hash := assessment.CalculateHash()
+	assessment.Hash = &hash
+	mustCreate(t, db, &assessment)
+	if _, err := consensus.Recalculate(db, fixture.Markup.ID); err != nil {
+		t.Fatalf("failed to recalculate consensus: %v", err)
+	}
+	db.Preload("Markup.Batch").First(&assessment, assessment.ID)
+	if ok, err := ledger.Settle(db, assessment); !ok || err != nil {
+		t.Fatalf("failed to settle assessment: %v", err)
+	}
+
+	w := serve(newTestRouter(db, admin), http.MethodPost, "/assessments", gin.H{
+		"markup_id": fixture.Markup.ID,
+		"fields":    []gin.H{{"markup_type_field_id": no.ID}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var entries []models.LedgerEntry
+	db.Where("assessment_id = ?", assessment.ID).Order("id").Find(&entries)
+	expected := []struct {
+		typeID uint
+		amount int64
+	}{
+		{ledgerEntryType.Credit, 100},
+		{ledgerEntryType.Reversal, -100},
+		{ledgerEntryType.Penalty, -30},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+	}
+	for i, entry := range entries {
+		if entry.TypeID != expected[i].typeID || entry.Amount != expected[i].amount {
+			t.Fatalf("unexpected entry %d: %+v", i, entry)
+		}
+	}
+}
+
+func TestAssessmentNextExampleAnswers(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	assessor := newTestUser(t, db, "assessor@example.com", &fixture.OrganizationID, permissions.AssessmentAssess)
+
+	// Prior assessment of fixture is the answer to example, another markup is left without answer.
+	unanswered := models.Markup{BatchID: fixture.Honeypot.ID, StatusID: markupStatus.Pending, Data: `{"text":"bye"}`}
+	mustCreate(t, db, &unanswered)
+	comment := "Greeting is positive"
+	mustCreate(t, db, &models.MarkupTypeExample{
+		MarkupTypeID: fixture.MarkupType.ID, MarkupID: fixture.Markup.ID, IsPositive: true, Comment: &comment,
+	})
+	mustCreate(t, db, &models.MarkupTypeExample{MarkupTypeID: fixture.MarkupType.ID, MarkupID: unanswered.ID})
+
+	w := serve(newTestRouter(db, assessor), http.MethodPost, "/assessments/next", gin.H{})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Examples []struct {
+			MarkupID   uint                   `json:"markup_id"`
+			IsPositive bool                   `json:"is_positive"`
+			Answer     []storeAssessmentField `json:"answer"`
+		} `json:"examples"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(response.Examples) != 2 {
+		t.Fatalf("expected 2 examples, got %s", w.Body.String())
+	}
+	for _, example := range response.Examples {
+		switch example.MarkupID {
+		case fixture.Markup.ID:
+			if !example.IsPositive || len(example.Answer) != 1 ||
+				example.Answer[0].MarkupTypeFieldID != fixture.MarkupType.Fields[0].ID {
+				t.Fatalf("expected prior assessment as answer, got %+v", example)
+			}
+		case unanswered.ID:
+			if example.Answer != nil {
+				t.Fatalf("expected no answer, got %+v", example)
+			}
+		default:
+			t.Fatalf("unexpected example %+v", example)
+		}
+	}
+}
+
+func TestAssessmentDestroyReopensCompletedBatch(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	manager := newTestUser(
+		t, db, "manager@example.com", &fixture.OrganizationID,
+		permissions.AssessmentDelete, permissions.AssessmentManage,
+	)
+
+	// Prior assessment of fixture processes its markup, so that batch is completed.
+	if _, err := consensus.Recalculate(db, fixture.Markup.ID); err != nil {
+		t.Fatalf("failed to recalculate consensus: %v", err)
+	}
+	db.Model(&fixture.Batch).Update("status_id", batchStatus.Completed)
+
+	w := serve(newTestRouter(db, manager), http.MethodDelete, fmt.Sprintf("/assessments/%d", fixture.Assessment.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var batch models.Batch
+	db.First(&batch, fixture.Batch.ID)
+	if batch.StatusID != batchStatus.Active {
+		t.Fatalf("expected batch to be reopened, got status %d", batch.StatusID)
+	}
+	var transition models.BatchTransition
+	if err := db.Where("batch_id = ?", batch.ID).Last(&transition).Error; err != nil {
+		t.Fatalf("expected transition to be recorded: %v", err)
+	}
+	if transition.FromStatusID != batchStatus.Completed || transition.ActorID != nil {
+		t.Fatalf("unexpected transition: %+v", transition)
+	}
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/validation/query"
+	"net/http"
+	"time"
+)
+
+type AuditLog struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewAuditLog(
+	log *slog.Logger,
+	db *gorm.DB,
+) *AuditLog {
+	return &AuditLog{
+		log: log,
+		db:  db,
+	}
+}
+
+// Index returns audit log from newest to oldest entries. Entries can be filtered by "actor_id", "action",
+// "entity_type", "entity_id" and by "from" and "to" timestamps in RFC 3339 format.
+func (con *AuditLog) Index(c *gin.Context) {
+	const op = "AuditLogController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	var page int
+	var perPage int
+	var err error
+
+	if page, err = query.DefaultInt(c, log, "page", "1"); err != nil {
+		return
+	}
+	if perPage, err = query.DefaultInt(c, log, "per_page", "10"); err != nil {
+		return
+	}
+	offset := (page - 1) * perPage
+
+	var from, to *time.Time
+	for key, dest := range map[string]**time.Time{"from": &from, "to": &to} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong " + key + " parameter"})
+			return
+		}
+		*dest = &t
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if actorID := query.Int(c, "actor_id"); actorID != nil {
+			db = db.Where("actor_id = ?", *actorID)
+		}
+		if action := c.Query("action"); action != "" {
+			db = db.Where("action = ?", action)
+		}
+		if entityType := c.Query("entity_type"); entityType != "" {
+			db = db.Where("entity_type = ?", entityType)
+		}
+		if entityID := query.Int(c, "entity_id"); entityID != nil {
+			db = db.Where("entity_id = ?", *entityID)
+		}
+		if from != nil {
+			db = db.Where("created_at >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where("created_at < ?", *to)
+		}
+		return db.Scopes(tenantScope(c, auditLogTenantCondition))
+	}
+
+	var total int64
+	if err := con.db.Model(&models.AuditLog{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Error("failed to count audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var entries []models.AuditLog
+	err = con.db.
+		Scopes(filter).
+		Order("id DESC").
+		Limit(perPage).
+		Offset(offset).
+		Find(&entries).Error
+	if err != nil {
+		log.Error("failed to find audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, responses.Pagination(entries, total, page, perPage))
+}
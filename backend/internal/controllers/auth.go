@@ -1,41 +1,61 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"log/slog"
 	"markup/internal/domain/enums/roles"
 	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
 	"markup/internal/lib/jwt"
+	"markup/internal/lib/loginlimit"
+	"markup/internal/lib/password"
 	"markup/internal/lib/responses"
+	"markup/internal/lib/token"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 )
 
 type Auth struct {
-	log       *slog.Logger
-	db        *gorm.DB
-	jwtSecret string
+	log              *slog.Logger
+	db               *gorm.DB
+	keySet           *jwt.KeySet
+	limiter          *loginlimit.Limiter
+	policy           password.Policy
+	openRegistration bool
 }
 
 func NewAuth(
 	log *slog.Logger,
 	db *gorm.DB,
-	jwtSecret string,
+	keySet *jwt.KeySet,
+	limiter *loginlimit.Limiter,
+	policy password.Policy,
+	openRegistration bool,
 ) *Auth {
 	return &Auth{
-		log:       log,
-		db:        db,
-		jwtSecret: jwtSecret,
+		log:              log,
+		db:               db,
+		keySet:           keySet,
+		limiter:          limiter,
+		policy:           policy,
+		openRegistration: openRegistration,
 	}
 }
 
 type register struct {
-	Email    string `json:"email" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	InviteCode string `json:"invite_code"`
 }
 
+// Register creates user. If invite code is given, user is granted role, organization and batches of the invite.
+// Otherwise, user becomes assessor, which is allowed only if open registration is enabled.
 func (con *Auth) Register(c *gin.Context) {
 	const op = "AuthController.Register"
 	log := con.log.With(slog.String("op", op))
@@ -46,9 +66,19 @@ func (con *Auth) Register(c *gin.Context) {
 		return
 	}
 
+	if data.InviteCode == "" && !con.openRegistration {
+		c.JSON(http.StatusForbidden, gin.H{"error": "registration is available by invite only"})
+		return
+	}
+	if err := con.policy.Validate(data.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var user models.User
 
 	user.Email = data.Email
+	user.CreatedAt = time.Now()
 
 	passHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -58,19 +88,74 @@ func (con *Auth) Register(c *gin.Context) {
 	}
 	user.Password = string(passHash)
 
-	// Find the roles
-	var assessorRole models.Role
-	if err := con.db.Find(&assessorRole, roles.Assessor).Error; err != nil {
+	tx := con.db.Begin()
+	if err := tx.Error; err != nil {
+		log.Error("failed to begin transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
-	user.Roles = []models.Role{
-		assessorRole,
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to create user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
 	}
 
-	if err := con.db.Create(&user).Error; err != nil {
-		log.Error("failed to create user", slog.Any("error", err))
+	if data.InviteCode != "" {
+		invite, err := useInvite(tx, data.InviteCode, user.ID)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, errInviteNotFound) || errors.Is(err, errInviteUsed) || errors.Is(err, errInviteExpired) {
+				log.Warn("invalid invite", slog.Any("error", err))
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			log.Error("failed to use invite", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+
+		if err := tx.Model(&user).Update("organization_id", invite.OrganizationID).Error; err != nil {
+			tx.Rollback()
+			log.Error("failed to set organization", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if err := tx.Model(&user).Association("Roles").Append(&invite.Role); err != nil {
+			tx.Rollback()
+			log.Error("failed to grant role", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if len(invite.Batches) > 0 {
+			if err := tx.Model(&user).Association("Batches").Append(invite.Batches); err != nil {
+				tx.Rollback()
+				log.Error("failed to grant batches", slog.Any("error", err))
+				responses.InternalServerError(c)
+				return
+			}
+		}
+	} else {
+		// Find the roles
+		var assessorRole models.Role
+		if err := tx.Find(&assessorRole, roles.Assessor).Error; err != nil {
+			tx.Rollback()
+			responses.InternalServerError(c)
+			return
+		}
+
+		if err := tx.Model(&user).Association("Roles").Append(&assessorRole); err != nil {
+			tx.Rollback()
+			log.Error("failed to grant role", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Error("failed to commit transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
@@ -78,11 +163,17 @@ func (con *Auth) Register(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
+// dummyPasswordHash is compared with password of unknown email, so that response time of login does not tell
+// whether account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
 type login struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// Login issues tokens in exchange for credentials. Failed attempts are recorded and throttled per client IP
+// and per account, so that locked clients are rejected before password is checked.
 func (con *Auth) Login(c *gin.Context) {
 	const op = "AuthController.Login"
 	log := con.log.With(slog.String("op", op))
@@ -93,81 +184,348 @@ func (con *Auth) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	wait, err := con.limiter.Check(c, ip, data.Email)
+	if err != nil {
+		log.Error("failed to check login limit", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
 	var user models.User
 	if err := con.db.Where("email = ?", data.Email).First(&user).Error; err != nil {
-		log.Warn("user not found", slog.Any("error", err))
-		responses.UnauthorizedError(c)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("failed to find user", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(data.Password))
+		con.loginFailed(c, log, data.Email, ip, "user not found")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
-		log.Error("invalid password", slog.Any("error", err))
+		con.loginFailed(c, log, data.Email, ip, "invalid password")
+		return
+	}
+	if user.IsDisabled {
+		log.Warn("user is disabled", slog.Any("user_id", user.ID))
 		responses.UnauthorizedError(c)
 		return
 	}
 
-	token, err := jwt.GenerateToken(user.ID, con.jwtSecret)
+	if err := con.limiter.Succeed(c, data.Email); err != nil {
+		log.Error("failed to reset login limit", slog.Any("error", err))
+	}
+
+	tokens, err := issueTokens(con.db, user, "", con.keySet)
 	if err != nil {
-		log.Error("failed to generate token", slog.Any("error", err))
+		log.Error("failed to issue tokens", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
 }
 
+// loginFailed records failed attempt, throttles client and sends response.
+func (con *Auth) loginFailed(c *gin.Context, log *slog.Logger, email string, ip string, reason string) {
+	log.Warn("login failed", slog.String("reason", reason), slog.String("ip", ip))
+
+	attempt := models.LoginAttempt{
+		Email:     email,
+		IP:        ip,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if err := con.db.Create(&attempt).Error; err != nil {
+		log.Error("failed to record login attempt", slog.Any("error", err))
+	}
+
+	wait, err := con.limiter.Fail(c, ip, email)
+	if err != nil {
+		log.Error("failed to register failed login", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if wait > 0 {
+		log.Warn("login locked", slog.String("ip", ip), slog.Duration("wait", wait))
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	responses.UnauthorizedError(c)
+}
+
+// tooManyAttempts sends response to client whose sign in attempts are locked for wait.
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts"})
+}
+
+type refresh struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges refresh token for new access and refresh tokens. Used refresh token is revoked.
+// If revoked token is presented again, it is considered stolen and whole its family is revoked.
 func (con *Auth) Refresh(c *gin.Context) {
 	const op = "AuthController.Refresh"
 	log := con.log.With(slog.String("op", op))
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+	var data refresh
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := jwt.ValidateToken(tokenString, con.jwtSecret)
-	if err != nil {
-		log.Error("invalid token", slog.Any("error", err))
+	tx := con.db.Begin()
+	if err := tx.Error; err != nil {
+		log.Error("failed to begin transaction", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var refreshToken models.RefreshToken
+	if err := tx.Where("token_hash = ?", token.Hash(data.RefreshToken)).First(&refreshToken).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("refresh token not found")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		log.Error("failed to find refresh token", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	log = log.With(slog.Any("user_id", refreshToken.UserID))
+
+	// Condition on revoked_at guarantees that token is rotated only once by concurrent requests.
+	now := time.Now()
+	result := tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", refreshToken.ID).
+		Update("revoked_at", now)
+	if err := result.Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to revoke refresh token", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if result.RowsAffected == 0 {
+		log.Warn("revoked refresh token is reused, revoking token family")
+		err := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", refreshToken.FamilyID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			tx.Rollback()
+			log.Error("failed to revoke token family", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			log.Error("failed to commit transaction", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	if now.After(refreshToken.ExpiresAt) {
+		tx.Rollback()
+		log.Warn("refresh token is expired")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	var user models.User
+	if err := tx.First(&user, refreshToken.UserID).Error; err != nil || user.IsDisabled {
+		tx.Rollback()
+		log.Warn("user not found or disabled", slog.Any("error", err))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 		return
 	}
 
-	newToken, err := jwt.GenerateToken(claims.UserID, con.jwtSecret)
+	tokens, err := issueTokens(tx, user, refreshToken.FamilyID, con.keySet)
 	if err != nil {
-		log.Error("failed to generate token", slog.Any("error", err))
+		tx.Rollback()
+		log.Error("failed to issue tokens", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	err = tx.Model(&refreshToken).Update("replaced_by_id", tokens.refreshTokenID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Error("failed to update refresh token", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	if err := tx.Commit().Error; err != nil {
+		log.Error("failed to commit transaction", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
 }
 
-func (con *Auth) Me(c *gin.Context) {
-	const op = "AuthController.Me"
+type logout struct {
+	RefreshToken string `json:"refresh_token"`
+	// All revokes all refresh and access tokens of user, signing them out on every device.
+	All bool `json:"all"`
+}
+
+// Logout revokes family of given refresh token or all tokens of authenticated user.
+func (con *Auth) Logout(c *gin.Context) {
+	const op = "AuthController.Logout"
 	log := con.log.With(slog.String("op", op))
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var data logout
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.All {
+		if err := revokeTokens(con.db, user.ID); err != nil {
+			log.Error("failed to revoke tokens", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		c.JSON(http.StatusOK, "OK")
+		return
+	}
+
+	if data.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
 		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := jwt.ValidateToken(tokenString, con.jwtSecret)
+	var refreshToken models.RefreshToken
+	err = con.db.
+		Where("token_hash = ? AND user_id = ?", token.Hash(data.RefreshToken), user.ID).
+		First(&refreshToken).Error
 	if err != nil {
-		log.Error("invalid token", slog.Any("error", err))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("refresh token not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find refresh token", slog.Any("error", err))
+		responses.InternalServerError(c)
 		return
 	}
 
-	var user models.User
-	if err := con.db.Preload("Roles").First(&user, claims.UserID).Error; err != nil {
-		log.Error("user not found", slog.Any("error", err))
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	err = con.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", refreshToken.FamilyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		log.Error("failed to revoke refresh tokens", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+type tokensResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	refreshTokenID uint
+}
+
+// refreshTTL is a lifetime of refresh token.
+const refreshTTL = 30 * 24 * time.Hour
+
+// issueTokens creates access token and refresh token of user. Refresh token joins familyID or starts new family
+// if familyID is empty.
+func issueTokens(db *gorm.DB, user models.User, familyID string, keySet *jwt.KeySet) (tokensResponse, error) {
+	const op = "Auth.issueTokens"
+
+	var res tokensResponse
+
+	accessToken, err := keySet.GenerateToken(user.ID, user.TokenVersion)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := token.Generate()
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	if familyID == "" {
+		if familyID, err = token.Generate(); err != nil {
+			return res, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	refreshToken := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: token.Hash(code),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res.Token = accessToken
+	res.RefreshToken = code
+	res.ExpiresIn = int(jwt.AccessTTL.Seconds())
+	res.refreshTokenID = refreshToken.ID
+
+	return res, nil
+}
+
+// revokeTokens revokes all refresh tokens of user and invalidates issued access tokens by incrementing
+// models.User TokenVersion.
+func revokeTokens(db *gorm.DB, userID uint) error {
+	const op = "Auth.revokeTokens"
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (con *Auth) Me(c *gin.Context) {
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
+
+// JWKS returns public keys that verify access tokens, so that other services can validate them.
+func (con *Auth) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": con.keySet.JWKS()})
+}
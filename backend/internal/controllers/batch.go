@@ -11,11 +11,18 @@ import (
 	"gorm.io/gorm"
 	"io"
 	"log/slog"
+	"markup/internal/domain/enums/batchStatus"
 	"markup/internal/domain/enums/markupStatus"
 	"markup/internal/domain/enums/roles"
 	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
 	"markup/internal/lib/auth"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/ledger"
+	"markup/internal/lib/lifecycle"
 	"markup/internal/lib/responses"
+	assessmentValidation "markup/internal/lib/validation/assessment"
+	"markup/internal/lib/validation/query"
 	"net/http"
 	"slices"
 	"strconv"
@@ -69,17 +76,18 @@ func (con *Batch) Index(c *gin.Context) {
 	isAdmin := user.HasRole(roles.Admin)
 
 	var total int64
-	tx := con.db.Model(&models.Batch{})
+	tx := con.db.Model(&models.Batch{}).Scopes(tenantScope(c, batchTenantCondition))
 	if !isAdmin {
-		tx = tx.Where("user_id = ? AND is_honeypot IS false", user.ID)
+		tx = tx.Where("is_honeypot IS false")
 	}
 	tx.Count(&total)
 
 	tx = con.db.Limit(perPage).
 		Offset(offset).
-		Order("created_at DESC")
+		Order("created_at DESC").
+		Scopes(tenantScope(c, batchTenantCondition))
 	if !isAdmin {
-		tx = tx.Where("user_id = ? AND is_honeypot IS false", user.ID)
+		tx = tx.Where("is_honeypot IS false")
 	}
 	tx.Find(&batches)
 
@@ -95,8 +103,9 @@ func (con *Batch) Find(c *gin.Context) {
 	var batch models.Batch
 	err := con.db.
 		Table("batches b").
-		Select("b.id,b.name,b.overlaps,b.priority,b.created_at,b.is_active,b.type_id").
+		Select("b.id,b.name,b.overlaps,b.priority,b.created_at,b.status_id,b.starts_at,b.ends_at,b.status_changed_at,b.max_assessments,b.max_daily_assessments,b.deadline,b.price,b.honeypot_bonus,b.rejection_penalty,b.type_id,b.organization_id").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
 		First(&batch).Error
 
 	if err != nil {
@@ -128,7 +137,7 @@ func (con *Batch) Find(c *gin.Context) {
 		Table("assessments a").
 		Select("DISTINCT a.id").
 		Joins("JOIN markups m ON a.markup_id = m.id").
-		Where("m.batch_id = ? AND a.hash IS NOT NULL", batch.ID).
+		Where("m.batch_id = ? AND a.hash IS NOT NULL AND a.invalidated_at IS NULL", batch.ID).
 		Count(&assessmentCount)
 
 	var correctAssessmentCount int64
@@ -136,11 +145,24 @@ func (con *Batch) Find(c *gin.Context) {
 		Table("assessments a").
 		Select("DISTINCT a.id").
 		Joins("JOIN markups m ON a.markup_id = m.id AND a.hash = m.correct_assessment_hash").
-		Where("m.batch_id = ? AND a.hash IS NOT NULL", batch.ID).
+		Where("m.batch_id = ? AND a.hash IS NOT NULL AND a.invalidated_at IS NULL", batch.ID).
 		Count(&correctAssessmentCount)
 
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+	quota, err := getBatchQuota(con.db, batch, user.ID, time.Now())
+	if err != nil {
+		log.Error("failed to count batch quota", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	var res struct {
 		models.Batch
+		batchQuota
 		MarkupCount            int64 `json:"markup_count"`
 		ProcessedMarkupCount   int64 `json:"processed_markup_count"`
 		AssessmentCount        int64 `json:"assessment_count"`
@@ -148,6 +170,7 @@ func (con *Batch) Find(c *gin.Context) {
 	}
 
 	res.Batch = batch
+	res.batchQuota = quota
 	res.MarkupCount = markupCount
 	res.ProcessedMarkupCount = processedMarkupCount
 	res.AssessmentCount = assessmentCount
@@ -174,6 +197,11 @@ func (con *Batch) Store(c *gin.Context) {
 		return
 	}
 
+	organizationID, ok := tenantOrganizationID(c)
+	if !ok {
+		return
+	}
+
 	// Handle file upload separately
 	file, err := c.FormFile("markups")
 	if err != nil {
@@ -189,12 +217,13 @@ func (con *Batch) Store(c *gin.Context) {
 	}
 
 	batch := models.Batch{
-		Name:      data.Name,
-		Overlaps:  data.Overlaps,
-		Priority:  data.Priority,
-		TypeID:    data.TypeID,
-		CreatedAt: time.Now(),
-		IsActive:  false,
+		Name:           data.Name,
+		Overlaps:       data.Overlaps,
+		Priority:       data.Priority,
+		TypeID:         data.TypeID,
+		CreatedAt:      time.Now(),
+		StatusID:       batchStatus.Draft,
+		OrganizationID: organizationID,
 	}
 
 	user, err := auth.User(c)
@@ -314,6 +343,13 @@ func (con *Batch) Store(c *gin.Context) {
 		}
 	}
 
+	if err := audit.Record(c, tx, audit.Create, audit.Batch, batch.ID, nil, batch); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		log.Error("failed to commit transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
@@ -325,12 +361,51 @@ func (con *Batch) Store(c *gin.Context) {
 	})
 }
 
+// optional is a value of request that tells omitted field from explicit null. Set reports whether field
+// is present in request, Value is nil if field is null.
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+// apply sets target to value of request if field is present in request.
+func (o optional[T]) apply(target **T) {
+	if o.Set {
+		*target = o.Value
+	}
+}
+
+// updateBatchType is a request to update models.Batch. Omitted optional fields are left unchanged,
+// null removes schedule, limits and deadline.
 type updateBatchType struct {
-	Name     string `binding:"required" json:"name"`
-	Overlaps int    `binding:"required" json:"overlaps"`
-	Priority int    `binding:"required" json:"priority"`
-	TypeID   uint   `binding:"required" json:"type_id"`
-	IsActive *bool  `binding:"required" json:"is_active"`
+	Name     string              `binding:"required" json:"name"`
+	Overlaps int                 `binding:"required" json:"overlaps"`
+	Priority int                 `binding:"required" json:"priority"`
+	TypeID   uint                `binding:"required" json:"type_id"`
+	StartsAt optional[time.Time] `json:"starts_at"`
+	EndsAt   optional[time.Time] `json:"ends_at"`
+	// Limits of batch, see models.Batch.
+	MaxAssessments      optional[int]       `json:"max_assessments"`
+	MaxDailyAssessments optional[int]       `json:"max_daily_assessments"`
+	Deadline            optional[time.Time] `json:"deadline"`
+	// Payment of assessments in minor currency units, see models.Batch.
+	Price            *int64 `binding:"omitempty,min=0" json:"price"`
+	HoneypotBonus    *int64 `binding:"omitempty,min=0" json:"honeypot_bonus"`
+	RejectionPenalty *int64 `binding:"omitempty,min=0" json:"rejection_penalty"`
 }
 
 func (con *Batch) Update(c *gin.Context) {
@@ -345,10 +420,19 @@ func (con *Batch) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if value := data.MaxAssessments.Value; value != nil && *value < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_assessments must be at least 1"})
+		return
+	}
+	if value := data.MaxDailyAssessments.Value; value != nil && *value < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_daily_assessments must be at least 1"})
+		return
+	}
 
 	var batch models.Batch
 	err := con.db.
 		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
 		First(&batch).Error
 
 	if err != nil {
@@ -365,13 +449,42 @@ func (con *Batch) Update(c *gin.Context) {
 		return
 	}
 
+	before := batch
 	batch.Name = data.Name
 	batch.Overlaps = data.Overlaps
 	batch.Priority = data.Priority
 	batch.TypeID = data.TypeID
-	batch.IsActive = *data.IsActive
+	data.StartsAt.apply(&batch.StartsAt)
+	data.EndsAt.apply(&batch.EndsAt)
+	data.MaxAssessments.apply(&batch.MaxAssessments)
+	data.MaxDailyAssessments.apply(&batch.MaxDailyAssessments)
+	data.Deadline.apply(&batch.Deadline)
+	if data.Price != nil {
+		batch.Price = *data.Price
+	}
+	if data.HoneypotBonus != nil {
+		batch.HoneypotBonus = *data.HoneypotBonus
+	}
+	if data.RejectionPenalty != nil {
+		batch.RejectionPenalty = *data.RejectionPenalty
+	}
 
-	if err := con.db.Save(&batch).Error; err != nil {
+	if batch.StartsAt != nil && batch.EndsAt != nil && !batch.StartsAt.Before(*batch.EndsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at must be before ends_at"})
+		return
+	}
+	if batch.StatusID == batchStatus.Scheduled && batch.StartsAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled batch requires starts_at"})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&batch).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Update, audit.Batch, batch.ID, before, batch)
+	})
+	if err != nil {
 		log.Error("failed to update batch type", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
@@ -380,15 +493,34 @@ func (con *Batch) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
-func (con *Batch) ToggleIsActive(c *gin.Context) {
-	const op = "BatchController.ToggleIsActive"
+type setBatchStatus struct {
+	StatusID uint `binding:"required" json:"status_id"`
+}
+
+// SetStatus moves batch to another status if transition is allowed, see lifecycle.CanTransition.
+// Batch can be scheduled only if it has starts_at in the future, and activated only if its ends_at has not passed.
+func (con *Batch) SetStatus(c *gin.Context) {
+	const op = "BatchController.SetStatus"
 	id := c.Param("id")
 
 	log := con.log.With(slog.String("op", op), slog.String("id", id))
 
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var data setBatchStatus
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var batch models.Batch
-	err := con.db.
+	err = con.db.
 		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
 		First(&batch).Error
 
 	if err != nil {
@@ -403,20 +535,80 @@ func (con *Batch) ToggleIsActive(c *gin.Context) {
 		return
 	}
 
-	batch.IsActive = !batch.IsActive
+	if !lifecycle.CanTransition(batch.StatusID, data.StatusID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("cannot move batch from status %d to %d", batch.StatusID, data.StatusID),
+		})
+		return
+	}
+	if data.StatusID == batchStatus.Scheduled && (batch.StartsAt == nil || batch.StartsAt.Before(time.Now())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot schedule batch without starts_at in the future"})
+		return
+	}
+	if data.StatusID == batchStatus.Active && batch.EndsAt != nil && batch.EndsAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot activate batch after its ends_at"})
+		return
+	}
+
+	before := batch
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := lifecycle.Transition(tx, &batch, data.StatusID, &user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Transition, audit.Batch, batch.ID, before, batch)
+	})
+	if err != nil {
+		if errors.Is(err, lifecycle.ErrStatusChanged) {
+			log.Warn("batch status was changed concurrently")
+			c.JSON(http.StatusConflict, gin.H{"error": "batch status was changed, try again"})
+			return
+		}
 
-	if err := con.db.Save(&batch).Error; err != nil {
-		con.db.Rollback()
-		log.Error("failed to toggle is_active field", slog.Any("error", err))
+		log.Error("failed to change batch status", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"is_active": batch.IsActive,
+		"status_id": batch.StatusID,
 	})
 }
 
+// Transitions returns history of status changes of batch from the first one.
+func (con *Batch) Transitions(c *gin.Context) {
+	const op = "BatchController.Transitions"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var batch models.Batch
+	err := con.db.
+		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		First(&batch).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("batch not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find batch", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var transitions []models.BatchTransition
+	if err := con.db.Where("batch_id = ?", batch.ID).Order("id").Find(&transitions).Error; err != nil {
+		log.Error("failed to find transitions", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, transitions)
+}
+
 func (con *Batch) Destroy(c *gin.Context) {
 	const op = "BatchController.Destroy"
 	id := c.Param("id")
@@ -431,9 +623,14 @@ func (con *Batch) Destroy(c *gin.Context) {
 type tieMarkupType struct {
 	BatchID      uint  `binding:"required" json:"batch_id"`
 	MarkupTypeID *uint `json:"markup_type_id"`
+	// FieldMapping maps ids of fields of previous markup types of the batch to indexes of fields of the new one.
+	FieldMapping map[uint]int `json:"field_mapping"`
 	storeMarkupType
 }
 
+// TieMarkupType creates copy of models.MarkupType that becomes current version of batch markup.
+// Assessments made with previous versions are migrated to the new fields according to FieldMapping.
+// Unfinished assessments and assessments of pending markups that can not be migrated are deleted.
 func (con *Batch) TieMarkupType(c *gin.Context) {
 	const op = "BatchController.TieMarkupType"
 	id := c.Param("id")
@@ -453,12 +650,20 @@ func (con *Batch) TieMarkupType(c *gin.Context) {
 		return
 	}
 
-	// delete assessments of pending markups
-	tx.Table("assessments a").
-		Joins("JOIN markups m ON m.id = assessments.markup_id").
-		Where("m.batch_id = ? AND m.status_id", data.BatchID, markupStatus.Pending)
-	if err := tx.Error; err != nil {
-		log.Error("failed to delete assessments", slog.Any("error", err))
+	var batch models.Batch
+	err := tx.
+		Where("id = ?", data.BatchID).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		First(&batch).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("batch not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find batch", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
@@ -466,12 +671,17 @@ func (con *Batch) TieMarkupType(c *gin.Context) {
 	var markupType models.MarkupType
 	if data.MarkupTypeID != nil {
 		var existingMarkupType models.MarkupType
+		// Fields are ordered, so that field_mapping refers to the same fields of copy by index.
 		err := con.db.
+			Preload("Fields", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
 			Preload("Fields.AssessmentType").
+			Preload("Examples").
 			Where("id = ?", data.MarkupTypeID).
+			Scopes(tenantScope(c, markupTypeTenantCondition)).
 			First(&existingMarkupType).Error
 
 		if err != nil {
+			tx.Rollback()
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				log.Warn("markupType not found")
 				responses.NotFoundError(c)
@@ -483,34 +693,76 @@ func (con *Batch) TieMarkupType(c *gin.Context) {
 			return
 		}
 
-		markupType = models.MarkupType{
-			Name: existingMarkupType.Name,
-		}
-		markupType.Fields = make([]models.MarkupTypeField, len(existingMarkupType.Fields))
-		for i, field := range existingMarkupType.Fields {
-			markupType.Fields[i] = models.MarkupTypeField{
-				AssessmentTypeID: field.AssessmentTypeID,
-				Name:             field.Name,
-				Label:            field.Label,
-				GroupID:          field.GroupID,
-			}
-		}
+		markupType = existingMarkupType.Copy()
 	} else {
 		markupType = models.MarkupType{
-			Name: data.Name,
+			Name:         data.Name,
+			Instructions: data.Instructions,
+			Examples:     data.examples(),
+		}
+		if err := validateMarkupTypeFields(data.Fields); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 		markupType.Fields = make([]models.MarkupTypeField, len(data.Fields))
 		for i, field := range data.Fields {
-			markupType.Fields[i] = models.MarkupTypeField{
-				AssessmentTypeID: field.AssessmentTypeID,
-				Name:             field.Name,
-				Label:            field.Label,
-				GroupID:          field.GroupID,
+			markupType.Fields[i] = field.toModel()
+		}
+		if err := validateExamples(con.db.Scopes(tenantScope(c, markupTenantCondition)), data.Examples); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errExampleMarkupNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+
+			log.Error("failed to validate examples", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+	}
+
+	// Check that mapped fields belong to previous versions of batch markup type.
+	oldFieldIDs := make([]uint, 0, len(data.FieldMapping))
+	for oldID, index := range data.FieldMapping {
+		if index < 0 || index >= len(markupType.Fields) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("field_mapping: field %d is mapped to unknown field index %d", oldID, index),
+			})
+			return
+		}
+		oldFieldIDs = append(oldFieldIDs, oldID)
+	}
+	if len(oldFieldIDs) > 0 {
+		var oldFields []models.MarkupTypeField
+		err := tx.
+			Joins("JOIN markup_types mt ON mt.id = markup_type_fields.markup_type_id").
+			Where("mt.batch_id = ? AND markup_type_fields.id IN ?", data.BatchID, oldFieldIDs).
+			Order("markup_type_fields.id").
+			Find(&oldFields).Error
+		if err != nil {
+			tx.Rollback()
+			log.Error("failed to check mapped fields", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if len(oldFields) != len(oldFieldIDs) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "field_mapping: some fields do not belong to markup types of the batch",
+			})
+			return
+		}
+		if err := validateFieldMapping(oldFields, markupType.Fields, data.FieldMapping); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 	}
 
 	markupType.BatchID = &data.BatchID
+	markupType.OrganizationID = batch.OrganizationID
 	markupType.CreatedAt = time.Now()
 	if err := tx.Save(&markupType).Error; err != nil {
 		tx.Rollback()
@@ -519,10 +771,15 @@ func (con *Batch) TieMarkupType(c *gin.Context) {
 		return
 	}
 
+	mapping := make(map[uint]uint, len(data.FieldMapping))
+	for oldID, index := range data.FieldMapping {
+		mapping[oldID] = markupType.Fields[index].ID
+	}
+
 	// Set child id of last MarkupType (parent).
 	var lastMarkupType models.MarkupType
 
-	err := tx.
+	err = tx.
 		Where(
 			"batch_id = ? AND id != ? AND child_id IS NULL",
 			markupType.BatchID,
@@ -549,13 +806,487 @@ func (con *Batch) TieMarkupType(c *gin.Context) {
 		}
 	}
 
+	summary, err := migrateAssessments(log, tx, data.BatchID, markupType, mapping)
+	if err != nil {
+		tx.Rollback()
+		responses.InternalServerError(c)
+		return
+	}
+
+	var previous any
+	if lastMarkupType.ID != 0 {
+		previous = gin.H{"markup_type_id": lastMarkupType.ID}
+	}
+	current := gin.H{"markup_type_id": markupType.ID, "field_mapping": data.FieldMapping, "summary": summary}
+	if err := audit.Record(c, tx, audit.Tie, audit.Batch, batch.ID, previous, current); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		log.Error("failed to commit transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
-	c.JSON(http.StatusOK, "OK")
+	c.JSON(http.StatusOK, gin.H{
+		"id":      markupType.ID,
+		"summary": summary,
+	})
+}
+
+// validateFieldMapping checks that fields of every previous markup type are mapped to distinct fields of the new
+// one with the same assessment type, so that migrated answers keep their meaning.
+func validateFieldMapping(oldFields []models.MarkupTypeField, fields []models.MarkupTypeField, mapping map[uint]int) error {
+	type target struct {
+		markupTypeID uint
+		index        int
+	}
+	targets := make(map[target]uint, len(oldFields))
+	for _, old := range oldFields {
+		index := mapping[old.ID]
+		key := target{old.MarkupTypeID, index}
+		if other, ok := targets[key]; ok {
+			return fmt.Errorf("field_mapping: fields %d and %d are mapped to the same field index %d", other, old.ID, index)
+		}
+		targets[key] = old.ID
+
+		if old.AssessmentTypeID != fields[index].AssessmentTypeID {
+			return fmt.Errorf("field_mapping: field %d is mapped to field index %d of another assessment type", old.ID, index)
+		}
+	}
+	return nil
+}
+
+// retypeSummary describes how existing assessments were affected by tying new models.MarkupType to models.Batch.
+type retypeSummary struct {
+	MigratedAssessments int `json:"migrated_assessments"`
+	DeletedAssessments  int `json:"deleted_assessments"`
+	ProcessedMarkups    int `json:"processed_markups"`
+}
+
+// migrateAssessments moves assessments of models.Batch to fields of new markupType according to mapping
+// (old models.MarkupTypeField id -> new models.MarkupTypeField id) and recalculates their hashes.
+// Assessments that are not finished yet and assessments of pending markups that can not be fully mapped or are not
+// valid for markupType after mapping are deleted along with their earnings, so that respective markups are assessed
+// again. Such assessments of processed markups are kept in history of previous markup type. Invalidated assessments
+// are left as is.
+func migrateAssessments(
+	log *slog.Logger,
+	tx *gorm.DB,
+	batchID uint,
+	markupType models.MarkupType,
+	mapping map[uint]uint,
+) (retypeSummary, error) {
+	const op = "Batch.migrateAssessments"
+	log = log.With(slog.String("op", op))
+
+	var summary retypeSummary
+
+	var assessments []models.Assessment
+	err := tx.
+		Preload("Fields.Spans").
+		Preload("Fields.Boxes").
+		Preload("Markup").
+		Joins("JOIN markups m ON m.id = assessments.markup_id").
+		Where("m.batch_id = ? AND assessments.invalidated_at IS NULL", batchID).
+		Find(&assessments).Error
+	if err != nil {
+		log.Error("failed to find assessments", slog.Any("error", err))
+		return summary, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleteIDs := make([]uint, 0)
+	// pending markups whose consensus may change after migration
+	recheck := make([]uint, 0)
+	// processed markups whose assessments were rehashed, their settled earnings may change
+	resettle := make([]uint, 0)
+
+	for _, assessment := range assessments {
+		isPending := assessment.Markup.StatusID == markupStatus.Pending
+
+		if assessment.Hash == nil {
+			deleteIDs = append(deleteIDs, assessment.ID)
+			recheck = append(recheck, assessment.MarkupID)
+			continue
+		}
+
+		isMappable := len(assessment.Fields) > 0
+		for _, field := range assessment.Fields {
+			if _, ok := mapping[field.MarkupTypeFieldID]; !ok {
+				isMappable = false
+				break
+			}
+		}
+
+		if isMappable {
+			mapped := slices.Clone(assessment.Fields)
+			for i, field := range mapped {
+				mapped[i].MarkupTypeFieldID = mapping[field.MarkupTypeFieldID]
+			}
+			isMappable = assessmentValidation.Validate(markupType, assessment.Markup.Data, mapped) == nil
+		}
+
+		if !isMappable {
+			// Answers of processed markups are kept in history of previous markup type.
+			if isPending {
+				deleteIDs = append(deleteIDs, assessment.ID)
+				recheck = append(recheck, assessment.MarkupID)
+			}
+			continue
+		}
+
+		oldHash := *assessment.Hash
+		for i, field := range assessment.Fields {
+			assessment.Fields[i].MarkupTypeFieldID = mapping[field.MarkupTypeFieldID]
+			err := tx.Model(&models.AssessmentField{}).
+				Where("id = ?", field.ID).
+				Update("markup_type_field_id", assessment.Fields[i].MarkupTypeFieldID).Error
+			if err != nil {
+				log.Error("failed to migrate assessment field", slog.Any("error", err))
+				return summary, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		hash := assessment.CalculateHash()
+		assessment.Hash = &hash
+		if err := tx.Model(&models.Assessment{}).Where("id = ?", assessment.ID).Update("hash", hash).Error; err != nil {
+			log.Error("failed to update assessment hash", slog.Any("error", err))
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if correctHash := assessment.Markup.CorrectAssessmentHash; correctHash != nil && *correctHash == oldHash {
+			err := tx.Model(&models.Markup{}).
+				Where("id = ?", assessment.MarkupID).
+				Update("correct_assessment_hash", hash).Error
+			if err != nil {
+				log.Error("failed to update correct assessment hash", slog.Any("error", err))
+				return summary, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if isPending {
+			recheck = append(recheck, assessment.MarkupID)
+		} else {
+			resettle = append(resettle, assessment.MarkupID)
+		}
+		summary.MigratedAssessments++
+	}
+
+	if len(deleteIDs) > 0 {
+		for _, id := range deleteIDs {
+			if err := ledger.Reverse(tx, id); err != nil {
+				log.Error("failed to reverse earnings", slog.Any("error", err))
+				return summary, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if err := tx.Where("id IN ?", deleteIDs).Delete(&models.Assessment{}).Error; err != nil {
+			log.Error("failed to delete assessments", slog.Any("error", err))
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	summary.DeletedAssessments = len(deleteIDs)
+
+	slices.Sort(recheck)
+	recheck = slices.Compact(recheck)
+	for _, markupID := range recheck {
+		if _, err := consensus.Recalculate(tx, markupID); err != nil {
+			log.Error("failed to recalculate consensus", slog.Any("error", err))
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var markup models.Markup
+		if err := tx.Where("id = ?", markupID).First(&markup).Error; err != nil {
+			log.Error("failed to find markup", slog.Any("error", err))
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+		if markup.StatusID == markupStatus.Processed {
+			summary.ProcessedMarkups++
+		}
+	}
+
+	slices.Sort(resettle)
+	for _, markupID := range slices.Compact(resettle) {
+		if _, ok := slices.BinarySearch(recheck, markupID); ok {
+			continue
+		}
+		if err := ledger.ResettleMarkup(tx, markupID); err != nil {
+			log.Error("failed to resettle earnings", slog.Any("error", err))
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return summary, nil
+}
+
+type markupTypeVersion struct {
+	models.MarkupType
+	Version                int   `json:"version"`
+	AssessmentCount        int64 `json:"assessment_count"`
+	CorrectAssessmentCount int64 `json:"correct_assessment_count"`
+}
+
+// MarkupTypeHistory returns all versions of models.MarkupType tied to models.Batch ordered from first to current
+// with assessment counts per version.
+func (con *Batch) MarkupTypeHistory(c *gin.Context) {
+	const op = "BatchController.MarkupTypeHistory"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var batch models.Batch
+	err := con.db.
+		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		First(&batch).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("batch not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find batch", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	chain, err := markupTypeChain(con.db.Scopes(tenantScope(c, markupTypeTenantCondition)), batch.ID)
+	if err != nil {
+		log.Error("failed to find markup types", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var counts []struct {
+		MarkupTypeID           uint
+		AssessmentCount        int64
+		CorrectAssessmentCount int64
+	}
+	err = con.db.
+		Table("markup_type_fields mtf").
+		Select("mtf.markup_type_id, COUNT(DISTINCT a.id) AS assessment_count, COUNT(DISTINCT a2.id) AS correct_assessment_count").
+		Joins("JOIN markup_types mt ON mt.id = mtf.markup_type_id").
+		Joins("JOIN assessment_fields af ON af.markup_type_field_id = mtf.id").
+		Joins("JOIN assessments a ON af.assessment_id = a.id AND a.hash IS NOT NULL AND a.invalidated_at IS NULL").
+		Joins("JOIN markups m ON a.markup_id = m.id").
+		Joins("LEFT JOIN assessments a2 ON af.assessment_id = a2.id AND a2.hash = m.correct_assessment_hash AND a2.invalidated_at IS NULL").
+		Where("mt.batch_id = ?", batch.ID).
+		Group("mtf.markup_type_id").
+		Scan(&counts).Error
+	if err != nil {
+		log.Error("failed to count assessments", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	res := make([]markupTypeVersion, len(chain))
+	for i, mt := range chain {
+		res[i] = markupTypeVersion{
+			MarkupType: mt,
+			Version:    i + 1,
+		}
+		for _, count := range counts {
+			if count.MarkupTypeID == mt.ID {
+				res[i].AssessmentCount = count.AssessmentCount
+				res[i].CorrectAssessmentCount = count.CorrectAssessmentCount
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+type markupTypeFieldChange struct {
+	From models.MarkupTypeField `json:"from"`
+	To   models.MarkupTypeField `json:"to"`
+}
+
+type markupTypeDiff struct {
+	From        markupTypeVersion        `json:"from"`
+	To          markupTypeVersion        `json:"to"`
+	Added       []models.MarkupTypeField `json:"added"`
+	Removed     []models.MarkupTypeField `json:"removed"`
+	Relabelled  []markupTypeFieldChange  `json:"relabelled"`
+	NameChanged bool                     `json:"name_changed"`
+	// InstructionsChanged is true if instructions, field help texts or examples differ.
+	InstructionsChanged bool `json:"instructions_changed"`
+}
+
+// MarkupTypeDiff compares two versions of models.MarkupType tied to models.Batch.
+// Versions are specified by "from" and "to" markup type ids. By default, current version is compared with previous one.
+func (con *Batch) MarkupTypeDiff(c *gin.Context) {
+	const op = "BatchController.MarkupTypeDiff"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var batch models.Batch
+	err := con.db.
+		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		First(&batch).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("batch not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find batch", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	chain, err := markupTypeChain(con.db.Scopes(tenantScope(c, markupTypeTenantCondition)), batch.ID)
+	if err != nil {
+		log.Error("failed to find markup types", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if len(chain) == 0 {
+		log.Warn("batch has no markup types")
+		responses.NotFoundError(c)
+		return
+	}
+
+	toIndex := len(chain) - 1
+	fromIndex := max(toIndex-1, 0)
+	for key, index := range map[string]*int{"from": &fromIndex, "to": &toIndex} {
+		markupTypeID := query.Int(c, key)
+		if markupTypeID == nil {
+			continue
+		}
+		*index = slices.IndexFunc(chain, func(mt models.MarkupType) bool {
+			return mt.ID == uint(*markupTypeID)
+		})
+		if *index < 0 {
+			log.Warn("markup type is not a version of batch", slog.String("param", key), slog.Int("markup_type_id", *markupTypeID))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("wrong %s parameter", key),
+			})
+			return
+		}
+	}
+
+	from := markupTypeVersion{MarkupType: chain[fromIndex], Version: fromIndex + 1}
+	to := markupTypeVersion{MarkupType: chain[toIndex], Version: toIndex + 1}
+
+	res := diffMarkupTypes(from.MarkupType, to.MarkupType)
+	res.From = from
+	res.To = to
+
+	c.JSON(http.StatusOK, res)
+}
+
+// markupTypeChain returns models.MarkupType versions of batch ordered from first to current by following ChildID.
+func markupTypeChain(db *gorm.DB, batchID any) ([]models.MarkupType, error) {
+	var markupTypes []models.MarkupType
+	err := db.
+		Preload("Fields.AssessmentType").
+		Preload("Examples").
+		Where("batch_id = ?", batchID).
+		Order("created_at, id").
+		Find(&markupTypes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.MarkupType, len(markupTypes))
+	isChild := make(map[uint]bool, len(markupTypes))
+	for _, mt := range markupTypes {
+		byID[mt.ID] = mt
+		if mt.ChildID != nil {
+			isChild[*mt.ChildID] = true
+		}
+	}
+
+	chain := make([]models.MarkupType, 0, len(markupTypes))
+	visited := make(map[uint]bool, len(markupTypes))
+	for _, root := range markupTypes {
+		if isChild[root.ID] {
+			continue
+		}
+		mt := root
+		for !visited[mt.ID] {
+			visited[mt.ID] = true
+			chain = append(chain, mt)
+			if mt.ChildID == nil {
+				break
+			}
+			next, ok := byID[*mt.ChildID]
+			if !ok {
+				break
+			}
+			mt = next
+		}
+	}
+
+	// Versions that are not reachable from any root (broken chain) are appended in creation order.
+	for _, mt := range markupTypes {
+		if !visited[mt.ID] {
+			chain = append(chain, mt)
+		}
+	}
+
+	return chain, nil
+}
+
+// diffMarkupTypes finds fields that were added, removed or relabelled between two versions of models.MarkupType.
+// Fields are matched by their keys since every version has its own copies of fields.
+func diffMarkupTypes(from models.MarkupType, to models.MarkupType) markupTypeDiff {
+	key := models.MarkupTypeField.FullKey
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	label := func(field models.MarkupTypeField) string {
+		return deref(field.Label)
+	}
+
+	fromFields := make(map[string]models.MarkupTypeField, len(from.Fields))
+	for _, field := range from.Fields {
+		fromFields[key(field)] = field
+	}
+	toFields := make(map[string]models.MarkupTypeField, len(to.Fields))
+	for _, field := range to.Fields {
+		toFields[key(field)] = field
+	}
+
+	res := markupTypeDiff{
+		Added:       make([]models.MarkupTypeField, 0),
+		Removed:     make([]models.MarkupTypeField, 0),
+		Relabelled:  make([]markupTypeFieldChange, 0),
+		NameChanged: from.Name != to.Name,
+		InstructionsChanged: deref(from.Instructions) != deref(to.Instructions) ||
+			!slices.EqualFunc(from.Examples, to.Examples, func(a, b models.MarkupTypeExample) bool {
+				return a.MarkupID == b.MarkupID && a.IsPositive == b.IsPositive && deref(a.Comment) == deref(b.Comment)
+			}),
+	}
+	for _, field := range to.Fields {
+		prev, ok := fromFields[key(field)]
+		if !ok {
+			res.Added = append(res.Added, field)
+			continue
+		}
+		if label(prev) != label(field) {
+			res.Relabelled = append(res.Relabelled, markupTypeFieldChange{From: prev, To: field})
+		}
+		if deref(prev.HelpText) != deref(field.HelpText) {
+			res.InstructionsChanged = true
+		}
+	}
+	for _, field := range from.Fields {
+		if _, ok := toFields[key(field)]; !ok {
+			res.Removed = append(res.Removed, field)
+		}
+	}
+
+	return res
 }
 
 func (con *Batch) Export(c *gin.Context) {
@@ -566,7 +1297,8 @@ func (con *Batch) Export(c *gin.Context) {
 	var batch models.Batch
 	err := con.db.
 		Where("id = ?", id).
-		Preload("MarkupTypes.Fields").
+		Scopes(tenantScope(c, batchTenantCondition)).
+		Preload("MarkupTypes.Fields", orderFields).
 		First(&batch).Error
 
 	if err != nil {
@@ -590,11 +1322,13 @@ func (con *Batch) Export(c *gin.Context) {
 		err := con.db.
 			Select("DISTINCT m.*").
 			Table("markups m").
-			Joins("LEFT JOIN assessments a ON a.markup_id = m.id AND a.hash = m.correct_assessment_hash").
+			Joins("LEFT JOIN assessments a ON a.markup_id = m.id AND a.hash = m.correct_assessment_hash AND a.invalidated_at IS NULL").
 			Joins("LEFT JOIN assessment_fields af ON af.assessment_id = a.id").
 			Joins("LEFT JOIN markup_type_fields mtf ON af.markup_type_field_id = mtf.id").
 			Where("mtf.markup_type_id = ? AND m.status_id = ?", mt.ID, markupStatus.Processed).
-			Preload("Assessments.Fields").
+			Preload("Assessments", "invalidated_at IS NULL").
+			Preload("Assessments.Fields.Spans").
+			Preload("Assessments.Fields.Boxes").
 			Find(&markups).Error
 		if err != nil {
 			log.Error("failed to find markups", slog.Any("error", err))
@@ -612,19 +1346,16 @@ func (con *Batch) Export(c *gin.Context) {
 
 		// markupTypeField ids for corresponding column name in csv column
 		markupTypeFieldIDs := make([]uint, len(mt.Fields))
+		// markupTypeField ids of fields that are exported with their values instead of "+" and "-"
+		valueFieldIDs := make(map[uint]bool)
 
-		// fill csv column names
+		// fill csv column names with stable field keys
 		for i, field := range mt.Fields {
-			var label string
-			if field.Label != nil {
-				label = *field.Label
-			}
-			var name string
-			if field.Label != nil {
-				name = *field.Name
-			}
-			csvHeaders[i+1] = fmt.Sprintf("%d.%s.%s", field.GroupID, label, name)
+			csvHeaders[i+1] = field.FullKey()
 			markupTypeFieldIDs[i] = field.ID
+			if assessmentValidation.IsValueType(field.AssessmentTypeID) {
+				valueFieldIDs[field.ID] = true
+			}
 		}
 
 		// create csv data
@@ -643,16 +1374,30 @@ func (con *Batch) Export(c *gin.Context) {
 				continue
 			}
 
-			//if assessment has asssessmentField corresponding to markupTypeField, write "+"
-		loop:
+			// prefer assessment that matches correct hash
+			correctAssessment := markup.Assessments[0]
+			for _, a := range markup.Assessments {
+				if a.Hash != nil && markup.CorrectAssessmentHash != nil && *a.Hash == *markup.CorrectAssessmentHash {
+					correctAssessment = a
+					break
+				}
+			}
+
+			//if assessment has asssessmentField corresponding to markupTypeField, write "+" or its value
 			for _, nextMTFID := range markupTypeFieldIDs {
-				if slices.ContainsFunc(markup.Assessments[0].Fields, func(n models.AssessmentField) bool {
+				i := slices.IndexFunc(correctAssessment.Fields, func(n models.AssessmentField) bool {
 					return n.MarkupTypeFieldID == nextMTFID
-				}) {
+				})
+				switch {
+				case i >= 0 && valueFieldIDs[nextMTFID]:
+					nextRow = append(nextRow, correctAssessment.Fields[i].Value())
+				case i >= 0:
 					nextRow = append(nextRow, "+")
-					continue loop
+				case valueFieldIDs[nextMTFID]:
+					nextRow = append(nextRow, "")
+				default:
+					nextRow = append(nextRow, "-")
 				}
-				nextRow = append(nextRow, "-")
 			}
 
 			csvData = append(csvData, nextRow)
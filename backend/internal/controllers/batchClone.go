@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/enums/markupStatus"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/responses"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Filters of markups copied by Batch.Clone.
+const (
+	cloneMarkupsAll = "all"
+	// cloneMarkupsUnprocessed copies markups that have not reached consensus.
+	cloneMarkupsUnprocessed = "unprocessed"
+	// cloneMarkupsDisputed copies markups whose valid assessments have different answers.
+	cloneMarkupsDisputed = "disputed"
+)
+
+type cloneBatch struct {
+	Name *string `json:"name"`
+	// Markups is a filter of markups to copy. Markups are not copied if it is omitted.
+	Markups *string `binding:"omitempty,oneof=all unprocessed disputed" json:"markups"`
+	// CopyGold copies prior assessments of copied markups, so that they keep their correct answers.
+	CopyGold bool `json:"copy_gold"`
+}
+
+type cloneSummary struct {
+	ID          uint `json:"id"`
+	MarkupCount int  `json:"markup_count"`
+	GoldCount   int  `json:"gold_count"`
+	// SkippedGoldCount is a number of prior assessments that were made with previous markup type of batch
+	// and can not be copied.
+	SkippedGoldCount int `json:"skipped_gold_count"`
+}
+
+// Clone creates a draft batch with settings and current markup type of batch. Markups are copied optionally,
+// all of them or only unprocessed or disputed ones, along with prior assessments if requested,
+// similar to the way Honeypot.Store copies a single markup.
+func (con *Batch) Clone(c *gin.Context) {
+	const op = "BatchController.Clone"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var data cloneBatch
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if data.CopyGold && data.Markups == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "copy_gold requires markups to be copied"})
+		return
+	}
+
+	var source models.Batch
+	err = con.db.
+		Preload("Users").
+		Preload("MarkupTypes", "child_id IS NULL").
+		Preload("MarkupTypes.Fields").
+		Preload("MarkupTypes.Examples").
+		Where("id = ?", id).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		First(&source).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("batch not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find batch", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if source.IsHoneypot {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot clone honeypot"})
+		return
+	}
+
+	name := fmt.Sprintf("%s (copy)", source.Name)
+	if data.Name != nil && *data.Name != "" {
+		name = *data.Name
+	}
+
+	batch := models.Batch{
+		Name:                name,
+		Overlaps:            source.Overlaps,
+		Priority:            source.Priority,
+		TypeID:              source.TypeID,
+		CreatedAt:           time.Now(),
+		StatusID:            batchStatus.Draft,
+		MaxAssessments:      source.MaxAssessments,
+		MaxDailyAssessments: source.MaxDailyAssessments,
+		Price:               source.Price,
+		HoneypotBonus:       source.HoneypotBonus,
+		RejectionPenalty:    source.RejectionPenalty,
+		OrganizationID:      source.OrganizationID,
+		Users:               source.Users,
+	}
+	isMember := slices.ContainsFunc(batch.Users, func(u models.User) bool { return u.ID == user.ID })
+	if !user.Can(permissions.TenantManage) && !isMember {
+		batch.Users = append(batch.Users, user)
+	}
+
+	summary := cloneSummary{}
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		summary.ID = batch.ID
+
+		// old markupTypeFieldID -> new markupTypeFieldID
+		MTFMap := make(map[uint]uint)
+		var markupType models.MarkupType
+		if len(source.MarkupTypes) > 0 {
+			markupType = source.MarkupTypes[0].Copy()
+			markupType.BatchID = &batch.ID
+			markupType.OrganizationID = batch.OrganizationID
+			markupType.UserID = &user.ID
+			markupType.CreatedAt = time.Now()
+			if err := tx.Create(&markupType).Error; err != nil {
+				return err
+			}
+			for i, field := range source.MarkupTypes[0].Fields {
+				MTFMap[field.ID] = markupType.Fields[i].ID
+			}
+		}
+
+		if data.Markups != nil {
+			// old markupID -> new markupID
+			markupMap := make(map[uint]uint)
+			err := con.cloneMarkups(tx, source.ID, batch.ID, *data.Markups, data.CopyGold, MTFMap, markupMap, &summary)
+			if err != nil {
+				return err
+			}
+
+			// Examples that refer to copied markups are moved to their copies.
+			for _, example := range markupType.Examples {
+				newID, ok := markupMap[example.MarkupID]
+				if !ok {
+					continue
+				}
+				if err := tx.Model(&example).Update("markup_id", newID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		after := gin.H{
+			"source_batch_id": source.ID,
+			"batch":           batch,
+			"summary":         summary,
+		}
+		return audit.Record(c, tx, audit.Clone, audit.Batch, batch.ID, nil, after)
+	})
+	if err != nil {
+		log.Error("failed to clone batch", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, summary)
+}
+
+// cloneMarkups copies markups of batch that match filter to another batch. Prior assessments are copied
+// with fields mapped by MTFMap if copyGold is set. Copied markup ids are added to markupMap.
+func (con *Batch) cloneMarkups(
+	tx *gorm.DB,
+	sourceID uint,
+	batchID uint,
+	filter string,
+	copyGold bool,
+	MTFMap map[uint]uint,
+	markupMap map[uint]uint,
+	summary *cloneSummary,
+) error {
+	query := tx.Where("batch_id = ?", sourceID)
+	switch filter {
+	case cloneMarkupsUnprocessed:
+		query = query.Where("status_id = ?", markupStatus.Pending)
+	case cloneMarkupsDisputed:
+		query = query.Where(
+			"id IN (SELECT markup_id FROM assessments WHERE hash IS NOT NULL AND invalidated_at IS NULL " +
+				"GROUP BY markup_id HAVING COUNT(DISTINCT hash) > 1)",
+		)
+	}
+	if copyGold {
+		query = query.
+			Preload("Assessments", "is_prior IS TRUE AND hash IS NOT NULL AND invalidated_at IS NULL").
+			Preload("Assessments.Fields.Spans").
+			Preload("Assessments.Fields.Boxes")
+	}
+
+	var markups []models.Markup
+	return query.Order("id").FindInBatches(&markups, 100, func(_ *gorm.DB, _ int) error {
+		newMarkups := make([]models.Markup, len(markups))
+		golds := make([]*models.Assessment, len(markups))
+		for i, markup := range markups {
+			newMarkups[i] = models.Markup{
+				BatchID:  batchID,
+				StatusID: markupStatus.Pending,
+				Data:     markup.Data,
+			}
+
+			if len(markup.Assessments) == 0 {
+				continue
+			}
+			gold, ok := copyGoldAssessment(markup.Assessments[0], MTFMap)
+			if !ok {
+				summary.SkippedGoldCount++
+				continue
+			}
+			golds[i] = &gold
+			newMarkups[i].StatusID = markupStatus.Processed
+			newMarkups[i].CorrectAssessmentHash = gold.Hash
+		}
+
+		if err := tx.Create(&newMarkups).Error; err != nil {
+			return err
+		}
+		summary.MarkupCount += len(newMarkups)
+
+		for i, markup := range markups {
+			markupMap[markup.ID] = newMarkups[i].ID
+			if golds[i] == nil {
+				continue
+			}
+			golds[i].MarkupID = newMarkups[i].ID
+			if err := tx.Create(golds[i]).Error; err != nil {
+				return err
+			}
+			summary.GoldCount++
+		}
+		return nil
+	}).Error
+}
+
+// copyGoldAssessment copies prior assessment with fields mapped to fields of new markup type.
+// Reports false if some field does not belong to markup type that was copied.
+func copyGoldAssessment(assessment models.Assessment, MTFMap map[uint]uint) (models.Assessment, bool) {
+	fields := make([]models.AssessmentField, len(assessment.Fields))
+	for i, field := range assessment.Fields {
+		newID, ok := MTFMap[field.MarkupTypeFieldID]
+		if !ok {
+			return models.Assessment{}, false
+		}
+		fields[i] = field.Copy()
+		fields[i].MarkupTypeFieldID = newID
+	}
+
+	gold := models.Assessment{
+		UserID:    assessment.UserID,
+		CreatedAt: time.Now(),
+		IsPrior:   true,
+		Fields:    fields,
+	}
+	hash := gold.CalculateHash()
+	gold.Hash = &hash
+	return gold, true
+}
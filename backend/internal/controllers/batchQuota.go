@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"markup/internal/domain/models"
+	"time"
+)
+
+var errQuotaExhausted = errors.New("quota exhausted")
+
+// dayStart returns start of the day (UTC) that daily limits of t are counted from.
+func dayStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// batchDeadlineScope limits query to batches, joined as alias, whose deadline has not passed.
+func batchDeadlineScope(alias string, now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(fmt.Sprintf("(%[1]s.deadline IS NULL OR %[1]s.deadline > ?)", alias), now)
+	}
+}
+
+// batchQuotaScope limits query to batches, joined as alias, that have assessments left within their total limit
+// and within daily limit of user.
+func batchQuotaScope(alias string, userID uint, now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where(fmt.Sprintf(
+				"(%[1]s.max_assessments IS NULL OR (SELECT COUNT(*) FROM assessments qa JOIN markups qm ON qm.id = qa.markup_id "+
+					"WHERE qm.batch_id = %[1]s.id AND qa.invalidated_at IS NULL) < %[1]s.max_assessments)",
+				alias,
+			)).
+			Where(fmt.Sprintf(
+				"(%[1]s.max_daily_assessments IS NULL OR (SELECT COUNT(*) FROM assessments qa JOIN markups qm ON qm.id = qa.markup_id "+
+					"WHERE qm.batch_id = %[1]s.id AND qa.user_id = ? AND qa.created_at >= ?) < %[1]s.max_daily_assessments)",
+				alias,
+			), userID, dayStart(now))
+	}
+}
+
+// batchQuota is a number of assessments that are left within limits of batch. Nil means no limit.
+type batchQuota struct {
+	RemainingAssessments      *int64 `json:"remaining_assessments"`
+	RemainingDailyAssessments *int64 `json:"remaining_daily_assessments"`
+}
+
+// getBatchQuota counts assessments that are left within limits of batch in total and for user today.
+// Unfinished assessments take quota too, since they are going to be finished.
+func getBatchQuota(db *gorm.DB, batch models.Batch, userID uint, now time.Time) (batchQuota, error) {
+	const op = "getBatchQuota"
+
+	var quota batchQuota
+
+	if batch.MaxAssessments != nil {
+		var count int64
+		err := db.Model(&models.Assessment{}).
+			Joins("JOIN markups m ON m.id = assessments.markup_id").
+			Where("m.batch_id = ? AND assessments.invalidated_at IS NULL", batch.ID).
+			Count(&count).Error
+		if err != nil {
+			return quota, fmt.Errorf("%s: %w", op, err)
+		}
+		remaining := max(int64(*batch.MaxAssessments)-count, 0)
+		quota.RemainingAssessments = &remaining
+	}
+
+	if batch.MaxDailyAssessments != nil {
+		var count int64
+		err := db.Model(&models.Assessment{}).
+			Joins("JOIN markups m ON m.id = assessments.markup_id").
+			Where("m.batch_id = ? AND assessments.user_id = ? AND assessments.created_at >= ?", batch.ID, userID, dayStart(now)).
+			Count(&count).Error
+		if err != nil {
+			return quota, fmt.Errorf("%s: %w", op, err)
+		}
+		remaining := max(int64(*batch.MaxDailyAssessments)-count, 0)
+		quota.RemainingDailyAssessments = &remaining
+	}
+
+	return quota, nil
+}
+
+// exhausted reports whether no assessments are left within some limit.
+func (q batchQuota) exhausted() bool {
+	return (q.RemainingAssessments != nil && *q.RemainingAssessments == 0) ||
+		(q.RemainingDailyAssessments != nil && *q.RemainingDailyAssessments == 0)
+}
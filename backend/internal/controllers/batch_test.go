@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBatchUpdateLimits(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	user := newTestUser(t, db, "client@example.com", &fixture.OrganizationID, clientPermissions...)
+	r := newTestRouter(db, user)
+
+	maxAssessments, maxDailyAssessments := 10, 5
+	startsAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	endsAt := startsAt.Add(48 * time.Hour)
+	deadline := startsAt.Add(24 * time.Hour)
+	db.Model(&fixture.Batch).Updates(models.Batch{
+		StartsAt:            &startsAt,
+		EndsAt:              &endsAt,
+		MaxAssessments:      &maxAssessments,
+		MaxDailyAssessments: &maxDailyAssessments,
+		Deadline:            &deadline,
+		Price:               100,
+		HoneypotBonus:       10,
+		RejectionPenalty:    50,
+	})
+
+	path := fmt.Sprintf("/batches/%d", fixture.Batch.ID)
+	body := gin.H{"name": "renamed", "overlaps": 1, "priority": 1, "type_id": 1}
+	find := func() models.Batch {
+		var batch models.Batch
+		db.First(&batch, fixture.Batch.ID)
+		return batch
+	}
+
+	// Omitted schedule, limits and payment are left unchanged.
+	w := serve(r, http.MethodPut, path, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	batch := find()
+	if batch.StartsAt == nil || !batch.StartsAt.Equal(startsAt) || batch.EndsAt == nil || !batch.EndsAt.Equal(endsAt) {
+		t.Fatalf("expected schedule to be left unchanged, got %+v", batch)
+	}
+	if batch.MaxAssessments == nil || *batch.MaxAssessments != maxAssessments ||
+		batch.MaxDailyAssessments == nil || *batch.MaxDailyAssessments != maxDailyAssessments ||
+		batch.Deadline == nil || !batch.Deadline.Equal(deadline) {
+		t.Fatalf("expected limits to be left unchanged, got %+v", batch)
+	}
+	if batch.Price != 100 || batch.HoneypotBonus != 10 || batch.RejectionPenalty != 50 {
+		t.Fatalf("expected payment to be left unchanged, got %+v", batch)
+	}
+
+	// Null removes limit and deadline.
+	body["max_assessments"] = nil
+	body["max_daily_assessments"] = 3
+	body["deadline"] = nil
+	w = serve(r, http.MethodPut, path, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	batch = find()
+	if batch.MaxAssessments != nil || batch.MaxDailyAssessments == nil || *batch.MaxDailyAssessments != 3 {
+		t.Fatalf("unexpected limits: %+v", batch)
+	}
+	if batch.Deadline != nil {
+		t.Fatalf("expected deadline to be removed, got %v", batch.Deadline)
+	}
+	if batch.StartsAt == nil || batch.EndsAt == nil {
+		t.Fatalf("expected schedule to be left unchanged, got %+v", batch)
+	}
+
+	// Schedule is checked with values that are left unchanged.
+	delete(body, "max_assessments")
+	delete(body, "max_daily_assessments")
+	delete(body, "deadline")
+	body["starts_at"] = endsAt.Add(time.Hour)
+	w = serve(r, http.MethodPut, path, body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	body["max_assessments"] = 0
+	delete(body, "starts_at")
+	w = serve(r, http.MethodPut, path, body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestTieMarkupTypeFieldMapping(t *testing.T) {
+	field := func(name string, groupID uint, typeID uint) gin.H {
+		return gin.H{"name": name, "label": "Question", "group_id": groupID, "assessment_type_id": typeID}
+	}
+
+	tests := []struct {
+		name    string
+		fields  []gin.H
+		mapping func(fixture tenantFixture, no models.MarkupTypeField) map[uint]int
+		code    int
+		deleted int
+	}{
+		{
+			"fields are mapped to the same field",
+			[]gin.H{field("Yes", 1, assessmentType.Radio), field("No", 1, assessmentType.Radio)},
+			func(fixture tenantFixture, no models.MarkupTypeField) map[uint]int {
+				return map[uint]int{fixture.MarkupType.Fields[0].ID: 0, no.ID: 0}
+			},
+			http.StatusBadRequest, 0,
+		},
+		{
+			"field is mapped to another assessment type",
+			[]gin.H{field("Comment", 1, assessmentType.Text), field("No", 2, assessmentType.Radio)},
+			func(fixture tenantFixture, no models.MarkupTypeField) map[uint]int {
+				return map[uint]int{fixture.MarkupType.Fields[0].ID: 0, no.ID: 1}
+			},
+			http.StatusBadRequest, 0,
+		},
+		{
+			"assessment without answer to new group is deleted",
+			[]gin.H{
+				field("Yes", 1, assessmentType.Radio),
+				field("No", 1, assessmentType.Radio),
+				field("Sure", 2, assessmentType.Radio),
+			},
+			func(fixture tenantFixture, no models.MarkupTypeField) map[uint]int {
+				return map[uint]int{fixture.MarkupType.Fields[0].ID: 0, no.ID: 1}
+			},
+			http.StatusOK, 1,
+		},
+		{
+			"valid assessment is migrated",
+			[]gin.H{field("Yes", 1, assessmentType.Radio), field("No", 1, assessmentType.Radio)},
+			func(fixture tenantFixture, no models.MarkupTypeField) map[uint]int {
+				return map[uint]int{fixture.MarkupType.Fields[0].ID: 0, no.ID: 1}
+			},
+			http.StatusOK, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			fixture := newTenantFixture(t, db, "own")
+			user := newTestUser(t, db, "client@example.com", &fixture.OrganizationID, clientPermissions...)
+
+			label := "No"
+			no := models.MarkupTypeField{
+				MarkupTypeID:     fixture.MarkupType.ID,
+				AssessmentTypeID: assessmentType.Radio,
+				Name:             &label,
+				Label:            &label,
+				GroupID:          1,
+				GroupKey:         "answer",
+				Key:              "no",
+			}
+			mustCreate(t, db, &no)
+
+			w := serve(newTestRouter(db, user), http.MethodPost, fmt.Sprintf("/batches/%d/markupTypes", fixture.Batch.ID), gin.H{
+				"batch_id":      fixture.Batch.ID,
+				"name":          "retyped",
+				"fields":        tt.fields,
+				"field_mapping": tt.mapping(fixture, no),
+			})
+			if w.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Summary retypeSummary `json:"summary"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if response.Summary.DeletedAssessments != tt.deleted {
+				t.Fatalf("expected %d deleted assessments, got %+v", tt.deleted, response.Summary)
+			}
+			if response.Summary.MigratedAssessments != 1-tt.deleted {
+				t.Fatalf("expected %d migrated assessments, got %+v", 1-tt.deleted, response.Summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/enums/ledgerEntryType"
+	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/validation/query"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ledgerEntryTenantCondition limits ledger entries to users of organization.
+const ledgerEntryTenantCondition = "le.user_id IN (SELECT id FROM users WHERE organization_id = ?)"
+
+type Earnings struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewEarnings(
+	log *slog.Logger,
+	db *gorm.DB,
+) *Earnings {
+	return &Earnings{
+		log: log,
+		db:  db,
+	}
+}
+
+// Index returns ledger entries of authenticated user from newest to oldest. Entries can be filtered
+// by "from" and "to" timestamps in RFC 3339 format.
+func (con *Earnings) Index(c *gin.Context) {
+	const op = "EarningsController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var page int
+	var perPage int
+
+	if page, err = query.DefaultInt(c, log, "page", "1"); err != nil {
+		return
+	}
+	if perPage, err = query.DefaultInt(c, log, "per_page", "10"); err != nil {
+		return
+	}
+	offset := (page - 1) * perPage
+
+	period, ok := periodScope(c, "created_at")
+	if !ok {
+		return
+	}
+	filter := func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", user.ID).Scopes(period)
+	}
+
+	var total int64
+	if err := con.db.Model(&models.LedgerEntry{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Error("failed to count ledger entries", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var entries []models.LedgerEntry
+	err = con.db.
+		Scopes(filter).
+		Order("id DESC").
+		Limit(perPage).
+		Offset(offset).
+		Find(&entries).Error
+	if err != nil {
+		log.Error("failed to find ledger entries", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, responses.Pagination(entries, total, page, perPage))
+}
+
+// earningsSummary is a sum of ledger entries of user by their type.
+type earningsSummary struct {
+	UserID   uint   `json:"user_id"`
+	Email    string `json:"email"`
+	Credit   int64  `json:"credit"`
+	Bonus    int64  `json:"bonus"`
+	Penalty  int64  `json:"penalty"`
+	Reversal int64  `json:"reversal"`
+	Balance  int64  `json:"balance"`
+	Count    int64  `json:"count"`
+}
+
+// Balance returns earnings of authenticated user by type of entries. Earnings can be limited to a period
+// by "from" and "to" timestamps in RFC 3339 format.
+func (con *Earnings) Balance(c *gin.Context) {
+	const op = "EarningsController.Balance"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	period, ok := periodScope(c, "le.created_at")
+	if !ok {
+		return
+	}
+
+	summaries, err := summarizeEarnings(con.db.Where("le.user_id = ?", user.ID).Scopes(period))
+	if err != nil {
+		log.Error("failed to summarize earnings", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	summary := earningsSummary{UserID: user.ID, Email: user.Email}
+	if len(summaries) > 0 {
+		summary = summaries[0]
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// Export sends CSV payout report with earnings of every user within period given by required "from" and "to"
+// timestamps in RFC 3339 format.
+func (con *Earnings) Export(c *gin.Context) {
+	const op = "EarningsController.Export"
+	log := con.log.With(slog.String("op", op))
+
+	if c.Query("from") == "" || c.Query("to") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to parameters are required"})
+		return
+	}
+	period, ok := periodScope(c, "le.created_at")
+	if !ok {
+		return
+	}
+
+	summaries, err := summarizeEarnings(con.db.Scopes(period, tenantScope(c, ledgerEntryTenantCondition)))
+	if err != nil {
+		log.Error("failed to summarize earnings", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	filename := "payouts_" + time.Now().Format("20060102_150405") + ".csv"
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	records := [][]string{{"user_id", "email", "credit", "bonus", "penalty", "reversal", "balance", "count"}}
+	for _, s := range summaries {
+		records = append(records, []string{
+			strconv.FormatUint(uint64(s.UserID), 10),
+			s.Email,
+			strconv.FormatInt(s.Credit, 10),
+			strconv.FormatInt(s.Bonus, 10),
+			strconv.FormatInt(s.Penalty, 10),
+			strconv.FormatInt(s.Reversal, 10),
+			strconv.FormatInt(s.Balance, 10),
+			strconv.FormatInt(s.Count, 10),
+		})
+	}
+	if err := writer.WriteAll(records); err != nil {
+		log.Error("failed to write payout report", slog.Any("error", err))
+	}
+}
+
+// summarizeEarnings sums ledger entries, aliased as le, found by db for every user.
+func summarizeEarnings(db *gorm.DB) ([]earningsSummary, error) {
+	sum := func(typeID uint) string {
+		return fmt.Sprintf("COALESCE(SUM(CASE WHEN le.type_id = %d THEN le.amount END), 0)", typeID)
+	}
+
+	var summaries []earningsSummary
+	err := db.
+		Table("ledger_entries le").
+		Select(
+			"le.user_id, u.email, " +
+				sum(ledgerEntryType.Credit) + " AS credit, " +
+				sum(ledgerEntryType.Bonus) + " AS bonus, " +
+				sum(ledgerEntryType.Penalty) + " AS penalty, " +
+				sum(ledgerEntryType.Reversal) + " AS reversal, " +
+				"COALESCE(SUM(le.amount), 0) AS balance, COUNT(*) AS count",
+		).
+		Joins("JOIN users u ON u.id = le.user_id").
+		Group("le.user_id, u.email").
+		Order("le.user_id").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// periodScope limits records by column of their time to "from" and "to" query parameters.
+// Sends response if parameters are invalid.
+func periodScope(c *gin.Context, column string) (func(db *gorm.DB) *gorm.DB, bool) {
+	var from, to *time.Time
+	for key, dest := range map[string]**time.Time{"from": &from, "to": &to} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong " + key + " parameter"})
+			return nil, false
+		}
+		*dest = &t
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if from != nil {
+			db = db.Where(column+" >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where(column+" < ?", *to)
+		}
+		return db
+	}, true
+}
@@ -7,9 +7,8 @@ import (
 	"gorm.io/gorm"
 	"log/slog"
 	"markup/internal/domain/enums/markupStatus"
-	"markup/internal/domain/enums/roles"
 	"markup/internal/domain/models"
-	"markup/internal/lib/auth"
+	"markup/internal/lib/audit"
 	"markup/internal/lib/responses"
 	"markup/internal/lib/validation/query"
 	"net/http"
@@ -49,31 +48,20 @@ func (con *Honeypot) Index(c *gin.Context) {
 	}
 	offset := (page - 1) * perPage
 
-	user, err := auth.User(c)
-	if err != nil {
-		responses.UnauthorizedError(c)
-		return
-	}
-	isAdmin := user.HasRole(roles.Admin)
-
 	var total int64
-	tx := con.db.Model(&models.Batch{})
-	if !isAdmin {
-		tx = tx.Where("user_id = ?", user.ID)
-	}
-	tx.Where("is_honeypot IS TRUE")
-	tx.Count(&total)
+	con.db.Model(&models.Batch{}).
+		Scopes(tenantScope(c, batchTenantCondition)).
+		Where("is_honeypot IS TRUE").
+		Count(&total)
 
-	tx = con.db.Limit(perPage).
+	con.db.Limit(perPage).
 		Offset(offset).
 		Order("created_at DESC").
 		Preload("Markups.Assessment.Fields").
-		Preload("MarkupTypes.Fields")
-	if !isAdmin {
-		tx = tx.Where("user_id = ?", user.ID)
-	}
-	tx.Where("is_honeypot IS TRUE")
-	tx.Find(&batches)
+		Preload("MarkupTypes.Fields").
+		Scopes(tenantScope(c, batchTenantCondition)).
+		Where("is_honeypot IS TRUE").
+		Find(&batches)
 
 	c.JSON(http.StatusOK, responses.Pagination(batches, total, page, perPage))
 }
@@ -88,8 +76,11 @@ func (con *Honeypot) Store(c *gin.Context) {
 	var markup models.Markup
 	err := con.db.
 		Preload("Batch.MarkupTypes.Fields").
-		Preload("Assessments.Fields").
+		Preload("Batch.MarkupTypes.Examples").
+		Preload("Assessments.Fields.Spans").
+		Preload("Assessments.Fields.Boxes").
 		Where("id = ?", markupID).
+		Scopes(tenantScope(c, markupTenantCondition)).
 		First(&markup).Error
 
 	if err != nil {
@@ -136,11 +127,16 @@ func (con *Honeypot) Store(c *gin.Context) {
 	}
 
 	newBatch := models.Batch{
-		Name:       fmt.Sprintf("HONEYPOT: %s", markup.Batch.Name),
-		Overlaps:   1000,
-		Priority:   50,
-		TypeID:     markup.Batch.TypeID,
-		IsHoneypot: true,
+		Name:           fmt.Sprintf("HONEYPOT: %s", markup.Batch.Name),
+		Overlaps:       1000,
+		Priority:       50,
+		TypeID:         markup.Batch.TypeID,
+		IsHoneypot:     true,
+		OrganizationID: markup.Batch.OrganizationID,
+		// Honeypot is paid as a task of source batch.
+		Price:            markup.Batch.Price,
+		HoneypotBonus:    markup.Batch.HoneypotBonus,
+		RejectionPenalty: markup.Batch.RejectionPenalty,
 	}
 
 	if err := tx.Create(&newBatch).Error; err != nil {
@@ -165,10 +161,13 @@ func (con *Honeypot) Store(c *gin.Context) {
 	}
 
 	newMarkupType := models.MarkupType{
-		BatchID:   &newBatch.ID,
-		Name:      markupType.Name,
-		ChildID:   nil,
-		CreatedAt: time.Now(),
+		BatchID:        &newBatch.ID,
+		OrganizationID: newBatch.OrganizationID,
+		Name:           markupType.Name,
+		Instructions:   markupType.Instructions,
+		ChildID:        nil,
+		CreatedAt:      time.Now(),
+		Examples:       markupType.Copy().Examples,
 	}
 
 	if err := tx.Create(&newMarkupType).Error; err != nil {
@@ -183,13 +182,8 @@ func (con *Honeypot) Store(c *gin.Context) {
 
 	newMarkupTypeFields := make([]models.MarkupTypeField, len(markupType.Fields))
 	for i, field := range markupType.Fields {
-		newMarkupTypeField := models.MarkupTypeField{
-			MarkupTypeID:     newMarkupType.ID,
-			AssessmentTypeID: field.AssessmentTypeID,
-			Name:             field.Name,
-			Label:            field.Label,
-			GroupID:          field.GroupID,
-		}
+		newMarkupTypeField := field.Copy()
+		newMarkupTypeField.MarkupTypeID = newMarkupType.ID
 		newMarkupTypeFields[i] = newMarkupTypeField
 
 		if err := tx.Create(&newMarkupTypeField).Error; err != nil {
@@ -204,10 +198,8 @@ func (con *Honeypot) Store(c *gin.Context) {
 
 	assessmentFields := make([]models.AssessmentField, len(assessment.Fields))
 	for i, field := range assessment.Fields {
-		assessmentFields[i] = models.AssessmentField{
-			MarkupTypeFieldID: MTFMap[field.MarkupTypeFieldID],
-			Text:              field.Text,
-		}
+		assessmentFields[i] = field.Copy()
+		assessmentFields[i].MarkupTypeFieldID = MTFMap[field.MarkupTypeFieldID]
 	}
 	newAssessment := models.Assessment{
 		MarkupID:  newMarkup.ID,
@@ -228,11 +220,25 @@ func (con *Honeypot) Store(c *gin.Context) {
 
 	newMarkup.CorrectAssessmentHash = &hash
 	if err := tx.Save(&newMarkup).Error; err != nil {
+		tx.Rollback()
 		log.Error("failed to update markup hash", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
 	}
 
+	after := gin.H{
+		"source_markup_id": markup.ID,
+		"batch_id":         newBatch.ID,
+		"markup_type_id":   newMarkupType.ID,
+		"assessment":       newAssessment,
+	}
+	if err := audit.Record(c, tx, audit.Create, audit.Honeypot, newMarkup.ID, nil, after); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		log.Error("failed to commit transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
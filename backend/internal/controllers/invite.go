@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/enums/roles"
+	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/token"
+	"markup/internal/lib/validation/query"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// defaultInviteTTL is a lifetime of invite if it is not specified in request.
+const defaultInviteTTL = 72 * time.Hour
+
+var (
+	errInviteNotFound = errors.New("invite not found")
+	errInviteUsed     = errors.New("invite is already used")
+	errInviteExpired  = errors.New("invite is expired")
+)
+
+type Invite struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewInvite(
+	log *slog.Logger,
+	db *gorm.DB,
+) *Invite {
+	return &Invite{
+		log: log,
+		db:  db,
+	}
+}
+
+// Index returns invites of organization that request is scoped to.
+func (con *Invite) Index(c *gin.Context) {
+	const op = "InviteController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	var page int
+	var perPage int
+	var err error
+
+	if page, err = query.DefaultInt(c, log, "page", "1"); err != nil {
+		return
+	}
+	if perPage, err = query.DefaultInt(c, log, "per_page", "10"); err != nil {
+		return
+	}
+	offset := (page - 1) * perPage
+
+	var total int64
+	err = con.db.Model(&models.Invite{}).
+		Scopes(tenantScope(c, inviteTenantCondition)).
+		Count(&total).Error
+	if err != nil {
+		log.Error("failed to count invites", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var invites []models.Invite
+	err = con.db.
+		Preload("Role").
+		Preload("Batches").
+		Scopes(tenantScope(c, inviteTenantCondition)).
+		Order("created_at DESC").
+		Limit(perPage).
+		Offset(offset).
+		Find(&invites).Error
+	if err != nil {
+		log.Error("failed to find invites", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, responses.Pagination(invites, total, page, perPage))
+}
+
+type storeInvite struct {
+	RoleID   uint   `binding:"required" json:"role_id"`
+	BatchIDs []uint `json:"batch_ids"`
+	// TTL is a lifetime of invite in hours.
+	TTL *int `binding:"omitempty,min=1" json:"ttl"`
+}
+
+// Store creates invite and returns its code. The code is returned only once.
+// Invites with admin role require permissions.UserManage.
+func (con *Invite) Store(c *gin.Context) {
+	const op = "InviteController.Store"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var data storeInvite
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.RoleID == roles.Admin && !user.Can(permissions.UserManage) {
+		responses.ForbiddenError(c)
+		return
+	}
+
+	organizationID, ok := tenantOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if err := con.db.Where("id = ?", data.RoleID).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+			return
+		}
+
+		log.Error("failed to find role", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	batchIDs := slices.Clone(data.BatchIDs)
+	slices.Sort(batchIDs)
+	batchIDs = slices.Compact(batchIDs)
+
+	var batches []models.Batch
+	if len(batchIDs) > 0 {
+		err := con.db.
+			Where("id IN ?", batchIDs).
+			Scopes(tenantScope(c, batchTenantCondition)).
+			Find(&batches).Error
+		if err != nil {
+			log.Error("failed to find batches", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+		if len(batches) != len(batchIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown batch"})
+			return
+		}
+	}
+
+	code, err := token.Generate()
+	if err != nil {
+		log.Error("failed to generate invite code", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if data.TTL != nil {
+		ttl = time.Duration(*data.TTL) * time.Hour
+	}
+
+	invite := models.Invite{
+		CodeHash:       token.Hash(code),
+		RoleID:         role.ID,
+		OrganizationID: organizationID,
+		CreatedByID:    user.ID,
+		ExpiresAt:      time.Now().Add(ttl),
+		CreatedAt:      time.Now(),
+		Batches:        batches,
+	}
+	if err := con.db.Create(&invite).Error; err != nil {
+		log.Error("failed to create invite", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         invite.ID,
+		"code":       code,
+		"expires_at": invite.ExpiresAt,
+	})
+}
+
+// Destroy revokes invite that is not used yet.
+func (con *Invite) Destroy(c *gin.Context) {
+	const op = "InviteController.Destroy"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var invite models.Invite
+	err := con.db.
+		Where("id = ?", id).
+		Scopes(tenantScope(c, inviteTenantCondition)).
+		First(&invite).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("invite not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find invite", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if invite.UsedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInviteUsed.Error()})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invite).Association("Batches").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&invite).Error
+	})
+	if err != nil {
+		log.Error("failed to delete invite", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// useInvite marks invite with code as used by user and returns it with role and batches.
+// Must be called within transaction together with user creation.
+func useInvite(tx *gorm.DB, code string, userID uint) (models.Invite, error) {
+	var invite models.Invite
+	err := tx.
+		Preload("Role").
+		Preload("Batches").
+		Where("code_hash = ?", token.Hash(code)).
+		First(&invite).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return invite, errInviteNotFound
+		}
+		return invite, err
+	}
+
+	if invite.UsedAt != nil {
+		return invite, errInviteUsed
+	}
+	if time.Now().After(invite.ExpiresAt) {
+		return invite, errInviteExpired
+	}
+
+	now := time.Now()
+	// Condition on used_at guarantees that concurrent registrations can not use the same invite.
+	result := tx.Model(&models.Invite{}).
+		Where("id = ? AND used_at IS NULL", invite.ID).
+		Updates(map[string]any{
+			"used_at":    now,
+			"used_by_id": userID,
+		})
+	if err := result.Error; err != nil {
+		return invite, err
+	}
+	if result.RowsAffected == 0 {
+		return invite, errInviteUsed
+	}
+	invite.UsedAt = &now
+	invite.UsedByID = &userID
+
+	return invite, nil
+}
@@ -57,11 +57,13 @@ func (con *Markup) Index(c *gin.Context) {
 	var total int64
 	con.db.Model(&models.Markup{}).
 		Where("batch_id = ?", batchID).
+		Scopes(tenantScope(c, markupTenantCondition)).
 		Count(&total)
 
 	con.db.Limit(perPage).
 		Preload("Assessments").
 		Where("batch_id = ?", batchID).
+		Scopes(tenantScope(c, markupTenantCondition)).
 		Order("correct_assessment_hash IS NULL, id asc").
 		Offset(offset).
 		Find(&markups)
@@ -84,6 +86,7 @@ func (con *Markup) Find(c *gin.Context) {
 	err := con.db.
 		Preload("Assessments").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, markupTenantCondition)).
 		First(&markup).Error
 
 	if err != nil {
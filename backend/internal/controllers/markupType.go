@@ -2,17 +2,25 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"log/slog"
 	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
 	"markup/internal/lib/auth"
 	"markup/internal/lib/responses"
+	assessmentValidation "markup/internal/lib/validation/assessment"
 	"markup/internal/lib/validation/query"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
+var errExampleMarkupNotFound = errors.New("example markup not found")
+
 type MarkupType struct {
 	log *slog.Logger
 	db  *gorm.DB
@@ -47,7 +55,7 @@ func (con *MarkupType) Index(c *gin.Context) {
 	offset := (page - 1) * perPage
 
 	var total int64
-	tx := con.db.Model(&models.MarkupType{})
+	tx := con.db.Model(&models.MarkupType{}).Scopes(tenantScope(c, markupTypeTenantCondition))
 	if batchID != nil {
 		if *batchID > 0 {
 			tx = tx.Where("batch_id = ?", batchID)
@@ -65,12 +73,13 @@ func (con *MarkupType) Index(c *gin.Context) {
 	}
 	tx = con.db.
 		Table("markup_types mt").
-		Select("mt.id,mt.batch_id,mt.name,mt.child_id,mt.user_id,mt.created_at,COUNT(DISTINCT a.markup_id) AS markup_count, COUNT(DISTINCT a.id) AS assessment_count,COUNT(DISTINCT a2.id) AS correct_assessment_count").
+		Select("mt.id,mt.batch_id,mt.name,mt.child_id,mt.user_id,mt.organization_id,mt.created_at,COUNT(DISTINCT a.markup_id) AS markup_count, COUNT(DISTINCT a.id) AS assessment_count,COUNT(DISTINCT a2.id) AS correct_assessment_count").
 		Joins("LEFT JOIN markup_type_fields mtf ON mt.id = mtf.markup_type_id").
 		Joins("LEFT JOIN assessment_fields af ON af.markup_type_field_id = mtf.id").
-		Joins("LEFT JOIN assessments a ON af.assessment_id = a.id and a.hash IS NOT NULL").
+		Joins("LEFT JOIN assessments a ON af.assessment_id = a.id and a.hash IS NOT NULL and a.invalidated_at IS NULL").
 		Joins("LEFT JOIN markups m ON a.markup_id = m.id").
-		Joins("LEFT JOIN assessments a2 ON af.assessment_id = a2.id and a2.hash IS NOT NULL and a2.hash = m.correct_assessment_hash").
+		Joins("LEFT JOIN assessments a2 ON af.assessment_id = a2.id and a2.hash IS NOT NULL and a2.invalidated_at IS NULL and a2.hash = m.correct_assessment_hash").
+		Scopes(tenantScope(c, "mt."+markupTypeTenantCondition)).
 		Group("mt.id").
 		Limit(perPage).
 		Offset(offset)
@@ -100,8 +109,11 @@ func (con *MarkupType) Find(c *gin.Context) {
 
 	var markupType models.MarkupType
 	err := con.db.
+		Preload("Fields", orderFields).
 		Preload("Fields.AssessmentType").
+		Preload("Examples.Markup").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, markupTypeTenantCondition)).
 		First(&markupType).Error
 
 	if err != nil {
@@ -122,15 +134,147 @@ func (con *MarkupType) Find(c *gin.Context) {
 }
 
 type storeMarkupType struct {
-	Name   string                 `binding:"required" json:"name"`
-	Fields []storeMarkupTypeField `binding:"required,dive" json:"fields"`
+	Name         string                   `binding:"required" json:"name"`
+	Instructions *string                  `json:"instructions"`
+	Fields       []storeMarkupTypeField   `binding:"required,dive" json:"fields"`
+	Examples     []storeMarkupTypeExample `binding:"dive" json:"examples"`
+}
+
+type storeMarkupTypeExample struct {
+	MarkupID   uint    `binding:"required" json:"markup_id"`
+	IsPositive bool    `json:"is_positive"`
+	Comment    *string `json:"comment"`
+}
+
+// examples converts request examples to models.MarkupTypeExample without identifiers.
+func (mt storeMarkupType) examples() []models.MarkupTypeExample {
+	examples := make([]models.MarkupTypeExample, len(mt.Examples))
+	for i, example := range mt.Examples {
+		examples[i] = models.MarkupTypeExample{
+			MarkupID:   example.MarkupID,
+			IsPositive: example.IsPositive,
+			Comment:    example.Comment,
+		}
+	}
+	return examples
 }
 
+// validateExamples checks that markups referenced by examples exist.
+func validateExamples(db *gorm.DB, examples []storeMarkupTypeExample) error {
+	if len(examples) == 0 {
+		return nil
+	}
+
+	markupIDs := make([]uint, len(examples))
+	for i, example := range examples {
+		markupIDs[i] = example.MarkupID
+	}
+	slices.Sort(markupIDs)
+	markupIDs = slices.Compact(markupIDs)
+
+	var count int64
+	if err := db.Model(&models.Markup{}).Where("id IN ?", markupIDs).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(markupIDs)) {
+		return errExampleMarkupNotFound
+	}
+	return nil
+}
+
+// storeMarkupTypeField is a field of markup type in request. GroupKey and Key are derived from GroupID and Name
+// if omitted, see withDefaultKeys.
 type storeMarkupTypeField struct {
-	Name             *string `binding:"required" json:"name"`
-	Label            *string `binding:"required" json:"label"`
-	GroupID          uint    `binding:"required" json:"group_id"`
-	AssessmentTypeID uint    `binding:"required" json:"assessment_type_id"`
+	Name             *string  `binding:"required" json:"name"`
+	Label            *string  `binding:"required" json:"label"`
+	HelpText         *string  `json:"help_text"`
+	GroupID          uint     `binding:"required" json:"group_id"`
+	AssessmentTypeID uint     `binding:"required" json:"assessment_type_id"`
+	GroupKey         string   `json:"group_key"`
+	Key              string   `json:"key"`
+	Position         int      `json:"position"`
+	Color            *string  `json:"color"`
+	Hotkey           *string  `json:"hotkey"`
+	IsDefault        bool     `json:"is_default"`
+	IsRequired       bool     `json:"is_required"`
+	MinLength        *int     `binding:"omitempty,min=0" json:"min_length"`
+	MaxLength        *int     `binding:"omitempty,min=1" json:"max_length"`
+	Pattern          *string  `json:"pattern"`
+	Min              *float64 `json:"min"`
+	Max              *float64 `json:"max"`
+	Step             *float64 `json:"step"`
+}
+
+// toModel converts request field to models.MarkupTypeField without identifiers.
+func (f storeMarkupTypeField) toModel() models.MarkupTypeField {
+	return models.MarkupTypeField{
+		Name:             f.Name,
+		Label:            f.Label,
+		HelpText:         f.HelpText,
+		GroupID:          f.GroupID,
+		GroupKey:         f.GroupKey,
+		Key:              f.Key,
+		Position:         f.Position,
+		Color:            f.Color,
+		Hotkey:           f.Hotkey,
+		IsDefault:        f.IsDefault,
+		AssessmentTypeID: f.AssessmentTypeID,
+		IsRequired:       f.IsRequired,
+		MinLength:        f.MinLength,
+		MaxLength:        f.MaxLength,
+		Pattern:          f.Pattern,
+		Min:              f.Min,
+		Max:              f.Max,
+		Step:             f.Step,
+	}
+}
+
+var keySeparatorRegexp = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// withDefaultKeys fills omitted keys of request fields as migration 000007 does for old fields: group key is
+// "group_<group id>", key is the name in lowercase with other characters replaced by '_' or "option_<n>"
+// if nothing is left of it. Derived keys that are already taken in group get a number suffix.
+func withDefaultKeys(fields []storeMarkupTypeField) {
+	taken := make(map[string]bool, len(fields))
+	for i := range fields {
+		if fields[i].GroupKey == "" {
+			fields[i].GroupKey = fmt.Sprintf("group_%d", fields[i].GroupID)
+		}
+		if fields[i].Key != "" {
+			taken[fields[i].GroupKey+"."+fields[i].Key] = true
+		}
+	}
+
+	for i, field := range fields {
+		if field.Key != "" {
+			continue
+		}
+		key := ""
+		if field.Name != nil {
+			key = strings.Trim(strings.ToLower(keySeparatorRegexp.ReplaceAllString(*field.Name, "_")), "_")
+		}
+		if key == "" {
+			key = fmt.Sprintf("option_%d", i+1)
+		}
+		base := key
+		for n := 2; taken[field.GroupKey+"."+key]; n++ {
+			key = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken[field.GroupKey+"."+key] = true
+		fields[i].Key = key
+	}
+}
+
+// validateMarkupTypeFields fills omitted keys of request fields and checks that they form a consistent
+// markup type schema.
+func validateMarkupTypeFields(fields []storeMarkupTypeField) error {
+	withDefaultKeys(fields)
+
+	schema := make([]models.MarkupTypeField, len(fields))
+	for i, field := range fields {
+		schema[i] = field.toModel()
+	}
+	return assessmentValidation.ValidateSchema(schema)
 }
 
 func (con *MarkupType) Store(c *gin.Context) {
@@ -143,6 +287,19 @@ func (con *MarkupType) Store(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateMarkupTypeFields(data.Fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !con.checkExamples(c, log, data.Examples) {
+		return
+	}
+
+	organizationID, ok := tenantOrganizationID(c)
+	if !ok {
+		return
+	}
 
 	tx := con.db.Begin()
 	if err := tx.Error; err != nil {
@@ -158,9 +315,12 @@ func (con *MarkupType) Store(c *gin.Context) {
 	}
 
 	markupType := models.MarkupType{
-		Name:      data.Name,
-		UserID:    &user.ID,
-		CreatedAt: time.Now(),
+		Name:           data.Name,
+		Instructions:   data.Instructions,
+		UserID:         &user.ID,
+		OrganizationID: organizationID,
+		CreatedAt:      time.Now(),
+		Examples:       data.examples(),
 	}
 
 	// todo: make only one query to save all models. See Assesment.Store
@@ -173,13 +333,8 @@ func (con *MarkupType) Store(c *gin.Context) {
 
 	fields := make([]models.MarkupTypeField, len(data.Fields))
 	for i, field := range data.Fields {
-		fields[i] = models.MarkupTypeField{
-			Name:             field.Name,
-			Label:            field.Label,
-			GroupID:          field.GroupID,
-			AssessmentTypeID: field.AssessmentTypeID,
-			MarkupTypeID:     markupType.ID,
-		}
+		fields[i] = field.toModel()
+		fields[i].MarkupTypeID = markupType.ID
 	}
 
 	if err := tx.Create(&fields).Error; err != nil {
@@ -188,6 +343,14 @@ func (con *MarkupType) Store(c *gin.Context) {
 		responses.InternalServerError(c)
 		return
 	}
+	markupType.Fields = fields
+
+	if err := audit.Record(c, tx, audit.Create, audit.MarkupType, markupType.ID, nil, markupType); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
 
 	if err := tx.Commit().Error; err != nil {
 		log.Error("failed to commit transaction", slog.Any("error", err))
@@ -201,11 +364,13 @@ func (con *MarkupType) Store(c *gin.Context) {
 }
 
 type updateMarkupType struct {
-	Name   string `binding:"required" json:"name"`
-	Fields []struct {
+	Name         string  `binding:"required" json:"name"`
+	Instructions *string `json:"instructions"`
+	Fields       []struct {
 		ID *uint `json:"id"`
 		storeMarkupTypeField
 	} `binding:"required" json:"fields"`
+	Examples []storeMarkupTypeExample `binding:"dive" json:"examples"`
 }
 
 func (con *MarkupType) Update(c *gin.Context) {
@@ -220,11 +385,27 @@ func (con *MarkupType) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	fields := make([]storeMarkupTypeField, len(data.Fields))
+	for i, field := range data.Fields {
+		fields[i] = field.storeMarkupTypeField
+	}
+	if err := validateMarkupTypeFields(fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range data.Fields {
+		data.Fields[i].storeMarkupTypeField = fields[i]
+	}
+	if !con.checkExamples(c, log, data.Examples) {
+		return
+	}
 
 	var markupType models.MarkupType
 	err := con.db.
 		Preload("Fields.AssessmentType").
+		Preload("Examples").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, markupTypeTenantCondition)).
 		First(&markupType).Error
 
 	if err != nil {
@@ -248,6 +429,28 @@ func (con *MarkupType) Update(c *gin.Context) {
 		return
 	}
 
+	// Forbid to take over fields of other markup types and to change keys of existing fields.
+	for _, field := range data.Fields {
+		if field.ID == nil {
+			continue
+		}
+		i := slices.IndexFunc(markupType.Fields, func(f models.MarkupTypeField) bool {
+			return f.ID == *field.ID
+		})
+		if i < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("field %d does not belong to markupType", *field.ID),
+			})
+			return
+		}
+		if existing := markupType.Fields[i]; existing.FullKey() != field.toModel().FullKey() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("key of field %d can not be changed from %s", *field.ID, existing.FullKey()),
+			})
+			return
+		}
+	}
+
 	tx := con.db.Begin()
 	if err := tx.Error; err != nil {
 		log.Error("failed to begin transaction", slog.Any("error", err))
@@ -255,7 +458,9 @@ func (con *MarkupType) Update(c *gin.Context) {
 		return
 	}
 
+	before := markupType
 	markupType.Name = data.Name
+	markupType.Instructions = data.Instructions
 
 	if err := tx.Save(&markupType).Error; err != nil {
 		tx.Rollback()
@@ -264,16 +469,30 @@ func (con *MarkupType) Update(c *gin.Context) {
 		return
 	}
 
+	if err := tx.Where("markup_type_id = ?", markupType.ID).Delete(&models.MarkupTypeExample{}).Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to delete markup type examples", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	examples := storeMarkupType{Examples: data.Examples}.examples()
+	for i := range examples {
+		examples[i].MarkupTypeID = markupType.ID
+	}
+	if len(examples) > 0 {
+		if err := tx.Create(&examples).Error; err != nil {
+			tx.Rollback()
+			log.Error("failed to create markup type examples", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+	}
+
 	processedIds := make([]uint, len(data.Fields))
 
 	for i, field := range data.Fields {
-		nextField := models.MarkupTypeField{
-			Name:             field.Name,
-			Label:            field.Label,
-			GroupID:          field.GroupID,
-			AssessmentTypeID: field.AssessmentTypeID,
-			MarkupTypeID:     markupType.ID,
-		}
+		nextField := field.toModel()
+		nextField.MarkupTypeID = markupType.ID
 
 		if field.ID != nil {
 			nextField.ID = *field.ID
@@ -304,6 +523,20 @@ func (con *MarkupType) Update(c *gin.Context) {
 		return
 	}
 
+	var after models.MarkupType
+	if err := tx.Preload("Fields.AssessmentType").Preload("Examples").First(&after, markupType.ID).Error; err != nil {
+		tx.Rollback()
+		log.Error("failed to find updated markup type", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if err := audit.Record(c, tx, audit.Update, audit.MarkupType, markupType.ID, before, after); err != nil {
+		tx.Rollback()
+		log.Error("failed to record audit log", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		log.Error("failed to commit transaction", slog.Any("error", err))
 		responses.InternalServerError(c)
@@ -313,6 +546,26 @@ func (con *MarkupType) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
+// orderFields orders preloaded models.MarkupTypeField by group and position within group.
+func orderFields(db *gorm.DB) *gorm.DB {
+	return db.Order("group_id, position, id")
+}
+
+// checkExamples validates examples and sends response if validation fails.
+func (con *MarkupType) checkExamples(c *gin.Context, log *slog.Logger, examples []storeMarkupTypeExample) bool {
+	if err := validateExamples(con.db.Scopes(tenantScope(c, markupTenantCondition)), examples); err != nil {
+		if errors.Is(err, errExampleMarkupNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+
+		log.Error("failed to validate examples", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+	return true
+}
+
 func (con *MarkupType) Destroy(c *gin.Context) {
 	const op = "MarkupTypeController.Destroy"
 	id := c.Param("id")
@@ -322,7 +575,9 @@ func (con *MarkupType) Destroy(c *gin.Context) {
 	var markupType models.MarkupType
 	err := con.db.
 		Preload("Fields.AssessmentType").
+		Preload("Examples").
 		Where("id = ?", id).
+		Scopes(tenantScope(c, markupTypeTenantCondition)).
 		First(&markupType).Error
 
 	if err != nil {
@@ -346,7 +601,13 @@ func (con *MarkupType) Destroy(c *gin.Context) {
 		return
 	}
 
-	if err := con.db.Delete(&models.MarkupType{}, id).Error; err != nil {
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.MarkupType{}, markupType.ID).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Delete, audit.MarkupType, markupType.ID, markupType, nil)
+	})
+	if err != nil {
 		log.Error("failed to delete markupType", slog.Any("error", err))
 		responses.InternalServerError(c)
 		return
@@ -354,3 +615,208 @@ func (con *MarkupType) Destroy(c *gin.Context) {
 
 	c.JSON(http.StatusOK, "OK")
 }
+
+// templateVersion is a version of markup type template format.
+const templateVersion = 1
+
+// markupTypeTemplate is a portable representation of models.MarkupType. Assessment types are referenced by name
+// instead of id, so that templates can be moved between databases.
+type markupTypeTemplate struct {
+	Version      int                       `json:"version" yaml:"version"`
+	Name         string                    `binding:"required" json:"name" yaml:"name"`
+	Instructions *string                   `json:"instructions,omitempty" yaml:"instructions,omitempty"`
+	Fields       []markupTypeTemplateField `binding:"required,dive" json:"fields" yaml:"fields"`
+}
+
+type markupTypeTemplateField struct {
+	GroupID        uint     `binding:"required" json:"group_id" yaml:"group_id"`
+	GroupKey       string   `binding:"required" json:"group_key" yaml:"group_key"`
+	Key            string   `binding:"required" json:"key" yaml:"key"`
+	Position       int      `json:"position" yaml:"position"`
+	Color          *string  `json:"color,omitempty" yaml:"color,omitempty"`
+	Hotkey         *string  `json:"hotkey,omitempty" yaml:"hotkey,omitempty"`
+	IsDefault      bool     `json:"is_default,omitempty" yaml:"is_default,omitempty"`
+	Name           *string  `binding:"required" json:"name" yaml:"name"`
+	Label          *string  `binding:"required" json:"label" yaml:"label"`
+	HelpText       *string  `json:"help_text,omitempty" yaml:"help_text,omitempty"`
+	AssessmentType string   `binding:"required" json:"assessment_type" yaml:"assessment_type"`
+	IsRequired     bool     `json:"is_required,omitempty" yaml:"is_required,omitempty"`
+	MinLength      *int     `json:"min_length,omitempty" yaml:"min_length,omitempty"`
+	MaxLength      *int     `json:"max_length,omitempty" yaml:"max_length,omitempty"`
+	Pattern        *string  `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Min            *float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max            *float64 `json:"max,omitempty" yaml:"max,omitempty"`
+	Step           *float64 `json:"step,omitempty" yaml:"step,omitempty"`
+}
+
+// Export returns models.MarkupType as template. Format is selected by "format" query param: json (default) or yaml.
+func (con *MarkupType) Export(c *gin.Context) {
+	const op = "MarkupTypeController.Export"
+	id := c.Param("id")
+
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format parameter"})
+		return
+	}
+
+	var markupType models.MarkupType
+	err := con.db.
+		Preload("Fields", orderFields).
+		Preload("Fields.AssessmentType").
+		Where("id = ?", id).
+		Scopes(tenantScope(c, markupTypeTenantCondition)).
+		First(&markupType).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("markupType not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find markupType", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	template := markupTypeTemplate{
+		Version:      templateVersion,
+		Name:         markupType.Name,
+		Instructions: markupType.Instructions,
+		Fields:       make([]markupTypeTemplateField, len(markupType.Fields)),
+	}
+	for i, field := range markupType.Fields {
+		template.Fields[i] = markupTypeTemplateField{
+			GroupID:        field.GroupID,
+			GroupKey:       field.GroupKey,
+			Key:            field.Key,
+			Position:       field.Position,
+			Color:          field.Color,
+			Hotkey:         field.Hotkey,
+			IsDefault:      field.IsDefault,
+			Name:           field.Name,
+			Label:          field.Label,
+			HelpText:       field.HelpText,
+			AssessmentType: field.AssessmentType.Name,
+			IsRequired:     field.IsRequired,
+			MinLength:      field.MinLength,
+			MaxLength:      field.MaxLength,
+			Pattern:        field.Pattern,
+			Min:            field.Min,
+			Max:            field.Max,
+			Step:           field.Step,
+		}
+	}
+
+	filename := fmt.Sprintf("markup-type-%d.%s", markupType.ID, format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	if format == "yaml" {
+		c.YAML(http.StatusOK, template)
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// Import creates models.MarkupType from template. Body is decoded according to Content-Type header:
+// application/json, application/yaml or application/x-yaml.
+func (con *MarkupType) Import(c *gin.Context) {
+	const op = "MarkupTypeController.Import"
+	log := con.log.With(slog.String("op", op))
+
+	var template markupTypeTemplate
+	if err := c.ShouldBind(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if template.Version > templateVersion {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unsupported template version %d", template.Version),
+		})
+		return
+	}
+
+	organizationID, ok := tenantOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	var assessmentTypes []models.AssessmentType
+	if err := con.db.Find(&assessmentTypes).Error; err != nil {
+		log.Error("failed to find assessment types", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	assessmentTypeIDs := make(map[string]uint, len(assessmentTypes))
+	for _, at := range assessmentTypes {
+		assessmentTypeIDs[strings.ToLower(at.Name)] = at.ID
+	}
+
+	markupType := models.MarkupType{
+		Name:           template.Name,
+		Instructions:   template.Instructions,
+		UserID:         &user.ID,
+		OrganizationID: organizationID,
+		CreatedAt:      time.Now(),
+		Fields:         make([]models.MarkupTypeField, len(template.Fields)),
+	}
+	for i, field := range template.Fields {
+		assessmentTypeID, ok := assessmentTypeIDs[strings.ToLower(field.AssessmentType)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("unknown assessment type %q", field.AssessmentType),
+			})
+			return
+		}
+
+		markupType.Fields[i] = models.MarkupTypeField{
+			AssessmentTypeID: assessmentTypeID,
+			Name:             field.Name,
+			Label:            field.Label,
+			HelpText:         field.HelpText,
+			GroupID:          field.GroupID,
+			GroupKey:         field.GroupKey,
+			Key:              field.Key,
+			Position:         field.Position,
+			Color:            field.Color,
+			Hotkey:           field.Hotkey,
+			IsDefault:        field.IsDefault,
+			IsRequired:       field.IsRequired,
+			MinLength:        field.MinLength,
+			MaxLength:        field.MaxLength,
+			Pattern:          field.Pattern,
+			Min:              field.Min,
+			Max:              field.Max,
+			Step:             field.Step,
+		}
+	}
+	if err := assessmentValidation.ValidateSchema(markupType.Fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&markupType).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Import, audit.MarkupType, markupType.ID, nil, markupType)
+	})
+	if err != nil {
+		log.Error("failed to create markup type", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id": markupType.ID,
+	})
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/models"
+	"net/http"
+	"testing"
+)
+
+func TestMarkupTypeStoreDefaultKeys(t *testing.T) {
+	db := newTestDB(t)
+	fixture := newTenantFixture(t, db, "own")
+	user := newTestUser(t, db, "client@example.com", &fixture.OrganizationID, clientPermissions...)
+	r := newTestRouter(db, user)
+
+	// Fields are sent without keys as MarkupForm does.
+	field := func(name string, groupID uint, typeID uint) gin.H {
+		return gin.H{"name": name, "label": "Question", "group_id": groupID, "assessment_type_id": typeID}
+	}
+	w := serve(r, http.MethodPost, "/markupTypes", gin.H{
+		"name": "keyless",
+		"fields": []gin.H{
+			field("Yes, sure", 1, assessmentType.Radio),
+			field("yes sure", 1, assessmentType.Radio),
+			field("Нет", 1, assessmentType.Radio),
+			field("", 2, assessmentType.Text),
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	var fields []models.MarkupTypeField
+	db.Where("markup_type_id = ?", response.ID).Order("id").Find(&fields)
+	expected := []string{"group_1.yes_sure", "group_1.yes_sure_2", "group_1.option_3", "group_2.option_4"}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %d", len(expected), len(fields))
+	}
+	for i, field := range fields {
+		if field.FullKey() != expected[i] {
+			t.Fatalf("expected key %s, got %s", expected[i], field.FullKey())
+		}
+	}
+
+	// Explicit keys are validated.
+	invalid := field("Yes", 1, assessmentType.Radio)
+	invalid["key"] = "Yes!"
+	w = serve(r, http.MethodPost, "/markupTypes", gin.H{"name": "invalid", "fields": []gin.H{invalid}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/jwt"
+	"markup/internal/lib/oidc"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/token"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcCookie keeps state, nonce and PKCE verifier of sign in flow between login and callback.
+const oidcCookie = "oidc_flow"
+
+var (
+	errSubjectMismatch = errors.New("user is linked to another identity")
+	errEmailTaken      = errors.New("email is used by another account")
+)
+
+// OIDCOptions describes how identities of OpenID provider are mapped to users.
+type OIDCOptions struct {
+	Enabled bool
+	// DefaultRole is a name of the role granted to users created on first sign in.
+	DefaultRole string
+	// GroupsClaim is a name of ID token claim that lists groups of user.
+	GroupsClaim string
+	// GroupRoles maps groups to role names. Mapped roles are granted on every sign in.
+	GroupRoles map[string]string
+	// FrontendURL receives tokens in URL fragment. Tokens are returned as JSON if it is empty.
+	FrontendURL string
+	// LinkByEmail links existing user to identity with the same email on first sign in if email is verified.
+	LinkByEmail bool
+}
+
+type OIDC struct {
+	log     *slog.Logger
+	db      *gorm.DB
+	keySet  *jwt.KeySet
+	cfg     oidc.Config
+	options OIDCOptions
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDC(
+	log *slog.Logger,
+	db *gorm.DB,
+	keySet *jwt.KeySet,
+	cfg oidc.Config,
+	options OIDCOptions,
+) *OIDC {
+	return &OIDC{
+		log:     log,
+		db:      db,
+		keySet:  keySet,
+		cfg:     cfg,
+		options: options,
+	}
+}
+
+// getProvider discovers provider on first use, so that unavailable provider does not prevent app from starting.
+func (con *OIDC) getProvider(c *gin.Context) (*oidc.Provider, error) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if con.provider != nil {
+		return con.provider, nil
+	}
+
+	provider, err := oidc.Discover(c, con.cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	con.provider = provider
+
+	return provider, nil
+}
+
+// Login redirects user to OpenID provider.
+func (con *OIDC) Login(c *gin.Context) {
+	const op = "OIDCController.Login"
+	log := con.log.With(slog.String("op", op))
+
+	if !con.options.Enabled {
+		responses.NotFoundError(c)
+		return
+	}
+
+	provider, err := con.getProvider(c)
+	if err != nil {
+		log.Error("failed to discover provider", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = token.Generate(); err != nil {
+			log.Error("failed to generate token", slog.Any("error", err))
+			responses.InternalServerError(c)
+			return
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	con.setCookie(c, strings.Join(values[:], "."), int((10 * time.Minute).Seconds()))
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, verifier))
+}
+
+// Callback completes sign in started by Login. User is found by subject or by verified email if linking is enabled,
+// or created if absent.
+// Roles mapped from groups of user are granted, and app tokens are issued.
+func (con *OIDC) Callback(c *gin.Context) {
+	const op = "OIDCController.Callback"
+	log := con.log.With(slog.String("op", op))
+
+	if !con.options.Enabled {
+		responses.NotFoundError(c)
+		return
+	}
+
+	flow, err := c.Cookie(oidcCookie)
+	con.setCookie(c, "", -1)
+	if err != nil {
+		log.Warn("flow cookie is missing")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sign in is not started or expired"})
+		return
+	}
+	values := strings.Split(flow, ".")
+	if len(values) != 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(c.Query("state"))) != 1 {
+		log.Warn("invalid state")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid state"})
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Warn("provider returned error", slog.String("error", providerError))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": providerError})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	provider, err := con.getProvider(c)
+	if err != nil {
+		log.Error("failed to discover provider", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	claims, err := provider.Exchange(c, code, verifier, nonce)
+	if err != nil {
+		log.Warn("failed to exchange code", slog.Any("error", err))
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	subject := oidc.StringClaim(claims, "sub")
+	email := oidc.StringClaim(claims, "email")
+	if subject == "" || email == "" {
+		log.Warn("id token has no subject or email")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "email is not provided"})
+		return
+	}
+	// Missing claim is treated as unverified email.
+	verified, ok := claims["email_verified"].(bool)
+	if ok && !verified {
+		log.Warn("email is not verified", slog.String("email", email))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "email is not verified"})
+		return
+	}
+	log = log.With(slog.String("subject", subject))
+
+	var user models.User
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = con.findOrCreateUser(tx, subject, email, con.options.LinkByEmail && verified)
+		if err != nil {
+			return err
+		}
+		return con.grantGroupRoles(tx, user, oidc.StringsClaim(claims, con.options.GroupsClaim))
+	})
+	if err != nil {
+		if errors.Is(err, errSubjectMismatch) {
+			log.Warn("user is linked to another subject", slog.String("email", email))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errEmailTaken) {
+			log.Warn("email is used by user that can not be linked", slog.String("email", email))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Error("failed to provision user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if user.IsDisabled {
+		log.Warn("user is disabled", slog.Any("user_id", user.ID))
+		responses.UnauthorizedError(c)
+		return
+	}
+
+	tokens, err := issueTokens(con.db, user, "", con.keySet)
+	if err != nil {
+		log.Error("failed to issue tokens", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	if con.options.FrontendURL == "" {
+		c.JSON(http.StatusOK, tokens)
+		return
+	}
+
+	fragment := url.Values{
+		"token":         {tokens.Token},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+	}
+	c.Redirect(http.StatusFound, con.options.FrontendURL+"#"+fragment.Encode())
+}
+
+// findOrCreateUser returns user linked to subject. User with the same email is linked to subject on first sign in
+// if linkEmail is set, otherwise errEmailTaken is returned. If there is no such user, it is created with default role
+// and random password.
+func (con *OIDC) findOrCreateUser(tx *gorm.DB, subject string, email string, linkEmail bool) (models.User, error) {
+	var user models.User
+
+	err := tx.Where("oidc_subject = ?", subject).First(&user).Error
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	err = tx.Where("email = ?", email).First(&user).Error
+	if err == nil {
+		if user.OIDCSubject != nil {
+			return user, errSubjectMismatch
+		}
+		if !linkEmail {
+			return user, errEmailTaken
+		}
+		user.OIDCSubject = &subject
+		return user, tx.Model(&user).Update("oidc_subject", subject).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	// Password is unknown to anybody, so that the user can sign in only through provider until it is reset.
+	password, err := token.Generate()
+	if err != nil {
+		return user, err
+	}
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+
+	user = models.User{
+		Email:       email,
+		Password:    string(passHash),
+		OIDCSubject: &subject,
+		CreatedAt:   time.Now(),
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return user, err
+	}
+
+	var role models.Role
+	if err := tx.Where("name = ?", con.options.DefaultRole).First(&role).Error; err != nil {
+		return user, err
+	}
+	return user, tx.Model(&user).Association("Roles").Append(&role)
+}
+
+// grantGroupRoles grants user roles mapped from groups. Roles are only added, so that roles granted in app are kept.
+func (con *OIDC) grantGroupRoles(tx *gorm.DB, user models.User, groups []string) error {
+	var names []string
+	for _, group := range groups {
+		if name, ok := con.options.GroupRoles[group]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var roles []models.Role
+	if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return tx.Model(&user).Association("Roles").Append(roles)
+}
+
+func (con *OIDC) setCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, value, maxAge, "/api/v1/auth/oidc", "", strings.HasPrefix(con.cfg.RedirectURL, "https://"), true)
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"io"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/jwt"
+	"markup/internal/lib/oidc"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testClientID = "markup"
+
+// mockProvider is OpenID provider that serves discovery, JWKS and token endpoints. ID token is signed with
+// signingKey and carries claims, nonce of authorization request is added unless claims override it.
+type mockProvider struct {
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	signingKey *rsa.PrivateKey
+	claims     jwtlib.MapClaims
+	nonce      string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	p := &mockProvider{key: key, signingKey: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   encode(p.key.N.Bytes()),
+				"e":   encode(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+
+		claims := jwtlib.MapClaims{
+			"iss":   p.server.URL,
+			"aud":   testClientID,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": p.nonce,
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		token := jwtlib.NewWithClaims(jwtlib.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(p.signingKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func newOIDCRouter(t *testing.T, db *gorm.DB, provider *mockProvider, options OIDCOptions) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	options.Enabled = true
+	options.DefaultRole = "assessor"
+	con := NewOIDC(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db,
+		jwt.NewHMACKeySet("secret"),
+		oidc.Config{
+			Issuer:      provider.server.URL,
+			ClientID:    testClientID,
+			RedirectURL: "http://localhost/api/v1/auth/oidc/callback",
+			Scopes:      []string{"openid", "email"},
+		},
+		options,
+	)
+
+	r := gin.New()
+	r.GET("/api/v1/auth/oidc/login", con.Login)
+	r.GET("/api/v1/auth/oidc/callback", con.Callback)
+	return r
+}
+
+// signIn starts sign in and completes it with callback. state replaces state returned by provider if it is set.
+func signIn(t *testing.T, r http.Handler, provider *mockProvider, state string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %v", err)
+	}
+	if provider.nonce == "" {
+		provider.nonce = location.Query().Get("nonce")
+	}
+	if state == "" {
+		state = location.Query().Get("state")
+	}
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/auth/oidc/callback?"+url.Values{"state": {state}, "code": {"code"}}.Encode(),
+		nil,
+	)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func newOIDCTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t)
+	mustCreate(t, db, &models.Role{ID: 3, Name: "assessor"})
+	return db
+}
+
+func TestOIDCCallback(t *testing.T) {
+	verifiedClaims := jwtlib.MapClaims{"sub": "subject", "email": "user@example.com", "email_verified": true}
+
+	t.Run("state mismatch", func(t *testing.T) {
+		db := newOIDCTestDB(t)
+		provider := newMockProvider(t)
+		provider.claims = verifiedClaims
+
+		w := signIn(t, newOIDCRouter(t, db, provider, OIDCOptions{}), provider, "forged")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		db := newOIDCTestDB(t)
+		provider := newMockProvider(t)
+		provider.claims = verifiedClaims
+		provider.nonce = "replayed"
+
+		w := signIn(t, newOIDCRouter(t, db, provider, OIDCOptions{}), provider, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		db := newOIDCTestDB(t)
+		provider := newMockProvider(t)
+		provider.claims = verifiedClaims
+		forged, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		provider.signingKey = forged
+
+		w := signIn(t, newOIDCRouter(t, db, provider, OIDCOptions{}), provider, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+		}
+		var count int64
+		db.Model(&models.User{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected no users, got %d", count)
+		}
+	})
+
+	t.Run("just-in-time provisioning", func(t *testing.T) {
+		db := newOIDCTestDB(t)
+		provider := newMockProvider(t)
+		provider.claims = verifiedClaims
+		r := newOIDCRouter(t, db, provider, OIDCOptions{})
+
+		for range 2 {
+			provider.nonce = ""
+			w := signIn(t, r, provider, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			var tokens tokensResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.Token == "" {
+				t.Fatalf("expected tokens, got %s", w.Body.String())
+			}
+		}
+
+		var users []models.User
+		db.Preload("Roles").Find(&users)
+		if len(users) != 1 {
+			t.Fatalf("expected 1 user, got %d", len(users))
+		}
+		user := users[0]
+		if user.Email != "user@example.com" || user.OIDCSubject == nil || *user.OIDCSubject != "subject" {
+			t.Fatalf("unexpected user: %+v", user)
+		}
+		if len(user.Roles) != 1 || user.Roles[0].Name != "assessor" {
+			t.Fatalf("expected assessor role, got %+v", user.Roles)
+		}
+	})
+
+	linking := []struct {
+		name        string
+		linkByEmail bool
+		claims      jwtlib.MapClaims
+		code        int
+	}{
+		{
+			"email is not linked by default", false,
+			verifiedClaims, http.StatusConflict,
+		},
+		{
+			"missing email_verified is not linked", true,
+			jwtlib.MapClaims{"sub": "subject", "email": "user@example.com"}, http.StatusConflict,
+		},
+		{
+			"verified email is linked", true,
+			verifiedClaims, http.StatusOK,
+		},
+	}
+	for _, tt := range linking {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newOIDCTestDB(t)
+			existing := newTestUser(t, db, "user@example.com", nil)
+			provider := newMockProvider(t)
+			provider.claims = tt.claims
+
+			w := signIn(t, newOIDCRouter(t, db, provider, OIDCOptions{LinkByEmail: tt.linkByEmail}), provider, "")
+			if w.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+
+			var user models.User
+			db.Where("id = ?", existing.ID).First(&user)
+			isLinked := user.OIDCSubject != nil && *user.OIDCSubject == "subject"
+			if isLinked != (tt.code == http.StatusOK) {
+				t.Fatalf("unexpected link of user: %+v", user)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/tenant"
+	"net/http"
+	"time"
+)
+
+// Conditions that limit queries to records of organization. Are used with tenantScope.
+const (
+	batchTenantCondition      = "organization_id = ?"
+	markupTypeTenantCondition = "organization_id = ?"
+	markupTenantCondition     = "batch_id IN (SELECT id FROM batches WHERE organization_id = ?)"
+	inviteTenantCondition     = "organization_id = ?"
+	auditLogTenantCondition   = "actor_id IN (SELECT id FROM users WHERE organization_id = ?)"
+	assessmentTenantCondition = "markup_id IN (SELECT m.id FROM markups m JOIN batches b ON b.id = m.batch_id WHERE b.organization_id = ?)"
+)
+
+// tenantScope limits query to records of organization that request is scoped to.
+// condition must contain single placeholder for organization id.
+func tenantScope(c *gin.Context, condition string) func(db *gorm.DB) *gorm.DB {
+	organizationID := tenant.ID(c)
+
+	return func(db *gorm.DB) *gorm.DB {
+		if organizationID == nil {
+			return db
+		}
+		return db.Where(condition, *organizationID)
+	}
+}
+
+// tenantOrganizationID returns organization that records created by request belong to, nil if request is not scoped.
+// Sends response and reports false if user does not belong to any organization, so that such users
+// do not share records with each other.
+func tenantOrganizationID(c *gin.Context) (*uint, bool) {
+	organizationID := tenant.ID(c)
+	if organizationID != nil && *organizationID == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user does not belong to organization"})
+		return nil, false
+	}
+	return organizationID, true
+}
+
+type Organization struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewOrganization(
+	log *slog.Logger,
+	db *gorm.DB,
+) *Organization {
+	return &Organization{
+		log: log,
+		db:  db,
+	}
+}
+
+func (con *Organization) Index(c *gin.Context) {
+	const op = "OrganizationController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	var organizations []models.Organization
+	if err := con.db.Order("name").Find(&organizations).Error; err != nil {
+		log.Error("failed to find organizations", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, organizations)
+}
+
+type storeOrganization struct {
+	Name string `binding:"required" json:"name"`
+}
+
+func (con *Organization) Store(c *gin.Context) {
+	const op = "OrganizationController.Store"
+	log := con.log.With(slog.String("op", op))
+
+	var data storeOrganization
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization := models.Organization{
+		Name:      data.Name,
+		CreatedAt: time.Now(),
+	}
+	if err := con.db.Create(&organization).Error; err != nil {
+		log.Error("failed to create organization", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id": organization.ID,
+	})
+}
+
+type attachOrganizationUser struct {
+	UserID uint `binding:"required" json:"user_id"`
+}
+
+// AttachUser moves user to organization.
+func (con *Organization) AttachUser(c *gin.Context) {
+	const op = "OrganizationController.AttachUser"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data attachOrganizationUser
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var organization models.Organization
+	if err := con.db.Where("id = ?", id).First(&organization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("organization not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find organization", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	result := con.db.Model(&models.User{}).
+		Where("id = ?", data.UserID).
+		Update("organization_id", organization.ID)
+	if err := result.Error; err != nil {
+		log.Error("failed to attach user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if result.RowsAffected == 0 {
+		log.Warn("user not found", slog.Any("user_id", data.UserID))
+		responses.NotFoundError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/jwt"
+	"markup/internal/lib/loginlimit"
+	"markup/internal/lib/mailer"
+	"markup/internal/lib/password"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/token"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	errResetNotFound = errors.New("invalid reset token")
+	errResetUsed     = errors.New("reset token is already used")
+	errResetExpired  = errors.New("reset token is expired")
+)
+
+// resetCooldown is a minimal interval between reset emails sent to the same user.
+const resetCooldown = time.Minute
+
+type Password struct {
+	log      *slog.Logger
+	db       *gorm.DB
+	keySet   *jwt.KeySet
+	limiter  *loginlimit.Limiter
+	mailer   mailer.Mailer
+	policy   password.Policy
+	resetURL string
+	resetTTL time.Duration
+}
+
+func NewPassword(
+	log *slog.Logger,
+	db *gorm.DB,
+	keySet *jwt.KeySet,
+	limiter *loginlimit.Limiter,
+	mailer mailer.Mailer,
+	policy password.Policy,
+	resetURL string,
+	resetTTL time.Duration,
+) *Password {
+	return &Password{
+		log:      log,
+		db:       db,
+		keySet:   keySet,
+		limiter:  limiter,
+		mailer:   mailer,
+		policy:   policy,
+		resetURL: resetURL,
+		resetTTL: resetTTL,
+	}
+}
+
+type changePassword struct {
+	CurrentPassword string `binding:"required" json:"current_password"`
+	NewPassword     string `binding:"required" json:"new_password"`
+}
+
+// Change sets new password of authenticated user. All other sessions of the user are signed out,
+// and new tokens are returned.
+func (con *Password) Change(c *gin.Context) {
+	const op = "PasswordController.Change"
+	log := con.log.With(slog.String("op", op))
+
+	user, err := auth.User(c)
+	if err != nil {
+		responses.UnauthorizedError(c)
+		return
+	}
+	if auth.IsAPIKey(c) {
+		responses.ForbiddenError(c)
+		return
+	}
+
+	var data changePassword
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.CurrentPassword)); err != nil {
+		log.Warn("invalid current password", slog.Any("user_id", user.ID))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid current password"})
+		return
+	}
+	if err := con.policy.Validate(data.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(data.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tokens tokensResponse
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(passHash)).Error; err != nil {
+			return err
+		}
+		if err := revokeTokens(tx, user.ID); err != nil {
+			return err
+		}
+		// Token version is changed by revokeTokens.
+		if err := tx.First(&user, user.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		tokens, err = issueTokens(tx, user, "", con.keySet)
+		return err
+	})
+	if err != nil {
+		log.Error("failed to change password", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+type forgotPassword struct {
+	Email string `binding:"required,email" json:"email"`
+}
+
+// Forgot sends password reset token to email of user. Response does not reveal whether user exists.
+func (con *Password) Forgot(c *gin.Context) {
+	const op = "PasswordController.Forgot"
+	log := con.log.With(slog.String("op", op))
+
+	var data forgotPassword
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := con.db.Where("email = ?", data.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("user not found")
+			c.JSON(http.StatusOK, "OK")
+			return
+		}
+
+		log.Error("failed to find user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	log = log.With(slog.Any("user_id", user.ID))
+
+	if user.IsDisabled {
+		log.Warn("user is disabled")
+		c.JSON(http.StatusOK, "OK")
+		return
+	}
+
+	var recent int64
+	err := con.db.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-resetCooldown)).
+		Count(&recent).Error
+	if err != nil {
+		log.Error("failed to count password resets", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if recent > 0 {
+		log.Warn("password reset is requested too often")
+		c.JSON(http.StatusOK, "OK")
+		return
+	}
+
+	code, err := token.Generate()
+	if err != nil {
+		log.Error("failed to generate reset token", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		// Only the latest token is valid.
+		err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordReset{}).Error
+		if err != nil {
+			return err
+		}
+		reset := models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: token.Hash(code),
+			ExpiresAt: time.Now().Add(con.resetTTL),
+			CreatedAt: time.Now(),
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		log.Error("failed to create password reset", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body:    con.resetBody(code),
+	}
+	// Email is sent in background, so that response time does not reveal whether user exists.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := con.mailer.Send(ctx, msg); err != nil {
+			log.Error("failed to send password reset email", slog.Any("error", err))
+		}
+	}()
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (con *Password) resetBody(code string) string {
+	body := "Somebody requested to reset your password. If it was not you, ignore this email.\n\n"
+
+	if con.resetURL == "" {
+		return body + "Your password reset token: " + code + "\n"
+	}
+
+	link := con.resetURL + "?" + url.Values{"token": {code}}.Encode()
+	return body + "Follow the link to set a new password: " + link + "\n"
+}
+
+type resetPasswordByToken struct {
+	Token    string `binding:"required" json:"token"`
+	Password string `binding:"required" json:"password"`
+}
+
+// Reset sets new password of user by reset token. Token is used once, and all sessions of the user are signed out.
+func (con *Password) Reset(c *gin.Context) {
+	const op = "PasswordController.Reset"
+	log := con.log.With(slog.String("op", op))
+
+	var data resetPasswordByToken
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := con.policy.Validate(data.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		reset, err := useReset(tx, data.Token)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password", string(passHash)).Error; err != nil {
+			return err
+		}
+		return revokeTokens(tx, user.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errResetNotFound) || errors.Is(err, errResetUsed) || errors.Is(err, errResetExpired) {
+			log.Warn("invalid reset token", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Error("failed to reset password", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	// Owner of the account has proven access to email, so that lockout of failed attempts is lifted.
+	if err := con.limiter.Unlock(c, user.Email); err != nil {
+		log.Error("failed to unlock account", slog.Any("error", err))
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// useReset marks reset token as used and returns it.
+func useReset(tx *gorm.DB, code string) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := tx.Where("token_hash = ?", token.Hash(code)).First(&reset).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return reset, errResetNotFound
+		}
+		return reset, err
+	}
+
+	if reset.UsedAt != nil {
+		return reset, errResetUsed
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return reset, errResetExpired
+	}
+
+	now := time.Now()
+	// Condition on used_at guarantees that concurrent requests can not use the same token.
+	result := tx.Model(&models.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL", reset.ID).
+		Update("used_at", now)
+	if err := result.Error; err != nil {
+		return reset, err
+	}
+	if result.RowsAffected == 0 {
+		return reset, errResetUsed
+	}
+	reset.UsedAt = &now
+
+	return reset, nil
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/responses"
+	"net/http"
+)
+
+type Permission struct {
+	log *slog.Logger
+	db  *gorm.DB
+}
+
+func NewPermission(
+	log *slog.Logger,
+	db *gorm.DB,
+) *Permission {
+	return &Permission{
+		log: log,
+		db:  db,
+	}
+}
+
+// Index returns all known permissions.
+func (con *Permission) Index(c *gin.Context) {
+	const op = "PermissionController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	var permissions []models.Permission
+	if err := con.db.Order("name").Find(&permissions).Error; err != nil {
+		log.Error("failed to find permissions", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// Roles returns all roles with their permissions.
+func (con *Permission) Roles(c *gin.Context) {
+	const op = "PermissionController.Roles"
+	log := con.log.With(slog.String("op", op))
+
+	var roles []models.Role
+	if err := con.db.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		log.Error("failed to find roles", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// User returns permissions granted to user directly and through roles.
+func (con *Permission) User(c *gin.Context) {
+	const op = "PermissionController.User"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	err := con.db.
+		Preload("Roles.Permissions").
+		Preload("Permissions").
+		Where("id = ?", id).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("user not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       user.Roles,
+		"permissions": user.Permissions,
+	})
+}
+
+type grantPermission struct {
+	Permission string `binding:"required" json:"permission"`
+}
+
+// GrantRole grants permission to role.
+func (con *Permission) GrantRole(c *gin.Context) {
+	const op = "PermissionController.GrantRole"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data grantPermission
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if !con.find(c, log, &role, id) {
+		return
+	}
+	var permission models.Permission
+	if !con.findPermission(c, log, &permission, data.Permission) {
+		return
+	}
+
+	if err := con.db.Model(&role).Association("Permissions").Append(&permission); err != nil {
+		log.Error("failed to grant permission", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// RevokeRole revokes permission from role.
+func (con *Permission) RevokeRole(c *gin.Context) {
+	const op = "PermissionController.RevokeRole"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var role models.Role
+	if !con.find(c, log, &role, id) {
+		return
+	}
+	var permission models.Permission
+	if !con.findPermission(c, log, &permission, c.Param("permission")) {
+		return
+	}
+
+	if err := con.db.Model(&role).Association("Permissions").Delete(&permission); err != nil {
+		log.Error("failed to revoke permission", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// GrantUser grants permission to user directly.
+func (con *Permission) GrantUser(c *gin.Context) {
+	const op = "PermissionController.GrantUser"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data grantPermission
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+	var permission models.Permission
+	if !con.findPermission(c, log, &permission, data.Permission) {
+		return
+	}
+
+	if err := con.db.Model(&user).Association("Permissions").Append(&permission); err != nil {
+		log.Error("failed to grant permission", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// RevokeUser revokes permission granted to user directly. Permissions granted through roles are not affected.
+func (con *Permission) RevokeUser(c *gin.Context) {
+	const op = "PermissionController.RevokeUser"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+	var permission models.Permission
+	if !con.findPermission(c, log, &permission, c.Param("permission")) {
+		return
+	}
+
+	if err := con.db.Model(&user).Association("Permissions").Delete(&permission); err != nil {
+		log.Error("failed to revoke permission", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// find loads model by id and sends response if fails.
+func (con *Permission) find(c *gin.Context, log *slog.Logger, dest any, id string) bool {
+	if err := con.db.Where("id = ?", id).First(dest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("model not found")
+			responses.NotFoundError(c)
+			return false
+		}
+
+		log.Error("failed to find model", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+	return true
+}
+
+// findPermission loads permission by name and sends response if fails.
+func (con *Permission) findPermission(c *gin.Context, log *slog.Logger, permission *models.Permission, name string) bool {
+	if err := con.db.Where("name = ?", name).First(permission).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("permission not found", slog.String("permission", name))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission"})
+			return false
+		}
+
+		log.Error("failed to find permission", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+	return true
+}
@@ -55,6 +55,8 @@ func (con *Profile) Me(c *gin.Context) {
 	}
 	con.db.
 		Preload("Assessments.Fields.MarkupTypeField").
+		Preload("Assessments.Fields.Spans").
+		Preload("Assessments.Fields.Boxes").
 		Preload("Assessments.Markup").
 		First(&user)
 
@@ -92,6 +94,8 @@ func (con *Profile) Find(c *gin.Context) {
 	err := con.db.
 		Preload("Roles").
 		Preload("Assessments.Fields.MarkupTypeField").
+		Preload("Assessments.Fields.Spans").
+		Preload("Assessments.Fields.Boxes").
 		Preload("Assessments.Markup").
 		Where("id = ?", id).
 		First(&user).Error
@@ -122,7 +126,7 @@ func getProfileData(db *gorm.DB, user models.User) profileResponse {
 		Joins("JOIN batches b ON m.batch_id = b.id").
 		Where("b.type_id = ?", 1).
 		Where("a.user_id = ?", user.ID).
-		Where("a.hash IS NOT NULL").
+		Where("a.hash IS NOT NULL AND a.invalidated_at IS NULL").
 		Count(&assessmentCount)
 
 	var correctAssessmentCount int64
@@ -133,7 +137,7 @@ func getProfileData(db *gorm.DB, user models.User) profileResponse {
 		Joins("JOIN batches b ON m.batch_id = b.id").
 		Where("b.type_id = ?", 1).
 		Where("a.user_id = ?", user.ID).
-		Where("a.hash IS NOT NULL").
+		Where("a.hash IS NOT NULL AND a.invalidated_at IS NULL").
 		Count(&correctAssessmentCount)
 
 	var assessmentCount2 int64
@@ -144,7 +148,7 @@ func getProfileData(db *gorm.DB, user models.User) profileResponse {
 		Joins("JOIN batches b ON m.batch_id = b.id").
 		Where("b.type_id = ?", 2).
 		Where("a.user_id = ?", user.ID).
-		Where("a.hash IS NOT NULL").
+		Where("a.hash IS NOT NULL AND a.invalidated_at IS NULL").
 		Count(&assessmentCount2)
 
 	var correctAssessmentCount2 int64
@@ -155,7 +159,7 @@ func getProfileData(db *gorm.DB, user models.User) profileResponse {
 		Joins("JOIN batches b ON m.batch_id = b.id").
 		Where("b.type_id = ?", 2).
 		Where("a.user_id = ?", user.ID).
-		Where("a.hash IS NOT NULL").
+		Where("a.hash IS NOT NULL AND a.invalidated_at IS NULL").
 		Count(&correctAssessmentCount2)
 
 	transformedAssessments := make([]profileResponseAssessment, len(user.Assessments))
@@ -0,0 +1,456 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"log/slog"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/enums/markupStatus"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/domain/models"
+	"markup/internal/lib/tenant"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestDB opens SQLite database in temporary directory with schema of the application.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		instance, _ := db.DB()
+		_ = instance.Close()
+	})
+
+	err = db.AutoMigrate(
+		&models.Organization{}, &models.User{}, &models.Role{}, &models.Permission{},
+		&models.Batch{}, &models.Markup{}, &models.MarkupType{},
+		&models.MarkupTypeField{}, &models.AssessmentType{},
+		&models.Assessment{}, &models.AssessmentField{},
+		&models.AssessmentSpan{}, &models.AssessmentBox{},
+		&models.MarkupTypeExample{}, &models.Invite{}, &models.RefreshToken{}, &models.APIKey{},
+		&models.LoginThrottle{}, &models.LoginAttempt{}, &models.PasswordReset{},
+		&models.AuditLog{}, &models.AssessmentRevision{},
+		&models.AssessmentInvalidation{}, &models.BatchTransition{},
+		&models.LedgerEntry{},
+	)
+	if err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	for id := uint(assessmentType.Radio); id <= assessmentType.BoundingBox; id++ {
+		mustCreate(t, db, &models.AssessmentType{ID: id, Name: fmt.Sprintf("type %d", id)})
+	}
+
+	return db
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value any) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("failed to create %T: %v", value, err)
+	}
+}
+
+// newTestUser creates user of organization with given permissions. organizationID may be nil.
+func newTestUser(t *testing.T, db *gorm.DB, email string, organizationID *uint, names ...string) models.User {
+	t.Helper()
+
+	user := models.User{Email: email, Password: "-", OrganizationID: organizationID}
+	for _, name := range names {
+		var permission models.Permission
+		if err := db.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+			t.Fatalf("failed to create permission: %v", err)
+		}
+		user.Permissions = append(user.Permissions, permission)
+	}
+	mustCreate(t, db, &user)
+	return user
+}
+
+// tenantFixture is a set of records that belong to single organization.
+type tenantFixture struct {
+	OrganizationID uint
+	Batch          models.Batch
+	MarkupType     models.MarkupType
+	Markup         models.Markup
+	Assessment     models.Assessment
+	Honeypot       models.Batch
+}
+
+func newTenantFixture(t *testing.T, db *gorm.DB, name string) tenantFixture {
+	t.Helper()
+
+	organization := models.Organization{Name: name, CreatedAt: time.Now()}
+	mustCreate(t, db, &organization)
+	assessor := newTestUser(t, db, name+"-assessor@example.com", &organization.ID, permissions.AssessmentAssess)
+
+	batch := models.Batch{
+		Name:           name,
+		Overlaps:       1,
+		Priority:       1,
+		TypeID:         1,
+		StatusID:       batchStatus.Active,
+		CreatedAt:      time.Now(),
+		OrganizationID: &organization.ID,
+		Users:          []models.User{assessor},
+	}
+	mustCreate(t, db, &batch)
+
+	label := "Yes"
+	markupType := models.MarkupType{
+		BatchID:        &batch.ID,
+		Name:           name,
+		OrganizationID: &organization.ID,
+		CreatedAt:      time.Now(),
+		Fields: []models.MarkupTypeField{{
+			AssessmentTypeID: assessmentType.Radio,
+			Name:             &label,
+			Label:            &label,
+			GroupID:          1,
+			GroupKey:         "answer",
+			Key:              "yes",
+		}},
+	}
+	mustCreate(t, db, &markupType)
+
+	markup := models.Markup{BatchID: batch.ID, StatusID: markupStatus.Pending, Data: `{"text":"hello"}`}
+	mustCreate(t, db, &markup)
+
+	assessment := models.Assessment{
+		MarkupID:  markup.ID,
+		UserID:    assessor.ID,
+		CreatedAt: time.Now(),
+		IsPrior:   true,
+		Fields:    []models.AssessmentField{{MarkupTypeFieldID: markupType.Fields[0].ID}},
+	}
+	hash := assessment.CalculateHash()
+	assessment.Hash = &hash
+	mustCreate(t, db, &assessment)
+
+	honeypot := models.Batch{
+		Name:           name + " honeypot",
+		Overlaps:       1,
+		Priority:       1,
+		TypeID:         1,
+		StatusID:       batchStatus.Active,
+		IsHoneypot:     true,
+		CreatedAt:      time.Now(),
+		OrganizationID: &organization.ID,
+	}
+	mustCreate(t, db, &honeypot)
+
+	return tenantFixture{
+		OrganizationID: organization.ID,
+		Batch:          batch,
+		MarkupType:     markupType,
+		Markup:         markup,
+		Assessment:     assessment,
+		Honeypot:       honeypot,
+	}
+}
+
+// newTestRouter registers scoped routes as server.NewRouter does. Requests are authenticated as user and scoped
+// to organization of user, as TenantMiddleware does for users without permissions.TenantManage.
+func newTestRouter(db *gorm.DB, user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	markupTypeCon := NewMarkupType(log, db)
+	batchCon := NewBatch(log, db)
+	markupCon := NewMarkup(log, db)
+	assessmentCon := NewAssessment(log, db)
+	honeypotCon := NewHoneypot(log, db)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		organizationID := user.OrganizationID
+		if organizationID == nil {
+			none := uint(0)
+			organizationID = &none
+		}
+		c.Set("user", user)
+		tenant.Set(c, organizationID)
+	})
+
+	markupTypes := r.Group("/markupTypes")
+	{
+		markupTypes.GET("", markupTypeCon.Index)
+		markupTypes.GET("/:id", markupTypeCon.Find)
+		markupTypes.POST("", markupTypeCon.Store)
+		markupTypes.GET("/:id/template", markupTypeCon.Export)
+		markupTypes.PUT("/:id", markupTypeCon.Update)
+		markupTypes.DELETE("/:id", markupTypeCon.Destroy)
+	}
+	batches := r.Group("/batches")
+	{
+		batches.GET("", batchCon.Index)
+		batches.GET("/:id", batchCon.Find)
+		batches.PUT("/:id", batchCon.Update)
+		batches.DELETE("/:id", batchCon.Destroy)
+		batches.POST("/:id/markupTypes", batchCon.TieMarkupType)
+		batches.GET("/:id/markupTypes", batchCon.MarkupTypeHistory)
+		batches.GET("/:id/markupTypes/diff", batchCon.MarkupTypeDiff)
+		batches.POST("/:id/clone", batchCon.Clone)
+		batches.PUT("/:id/status", batchCon.SetStatus)
+		batches.GET("/:id/transitions", batchCon.Transitions)
+		batches.GET("/:id/export", batchCon.Export)
+	}
+	markups := r.Group("/markups")
+	{
+		markups.GET("", markupCon.Index)
+		markups.GET("/:id", markupCon.Find)
+	}
+	assessments := r.Group("/assessments")
+	{
+		assessments.GET("", assessmentCon.Index)
+		assessments.GET("/:id", assessmentCon.Find)
+		assessments.POST("", assessmentCon.Store)
+		assessments.POST("/next", assessmentCon.Next)
+		assessments.PUT("/:id", assessmentCon.Update)
+		assessments.DELETE("/:id", assessmentCon.Destroy)
+		assessments.GET("/:id/revisions", assessmentCon.Revisions)
+	}
+	honeypots := r.Group("/honeypots")
+	{
+		honeypots.GET("", honeypotCon.Index)
+		honeypots.POST("/:id", honeypotCon.Store)
+	}
+
+	return r
+}
+
+func serve(r http.Handler, method string, path string, body any) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// clientPermissions are permissions that scoped routes require.
+var clientPermissions = []string{
+	permissions.BatchRead, permissions.BatchCreate, permissions.BatchUpdate, permissions.BatchDelete,
+	permissions.BatchExport, permissions.MarkupTypeRead, permissions.MarkupTypeCreate, permissions.MarkupTypeUpdate,
+	permissions.MarkupTypeDelete, permissions.MarkupRead, permissions.AssessmentRead, permissions.AssessmentManage,
+	permissions.AssessmentDelete, permissions.HoneypotRead, permissions.HoneypotManage,
+}
+
+func TestTenantIsolation(t *testing.T) {
+	db := newTestDB(t)
+	own := newTenantFixture(t, db, "own")
+	other := newTenantFixture(t, db, "other")
+	user := newTestUser(t, db, "client@example.com", &own.OrganizationID, clientPermissions...)
+	r := newTestRouter(db, user)
+
+	label := "Yes"
+	markupTypeBody := gin.H{
+		"name": "renamed",
+		"fields": []gin.H{{
+			"name":               label,
+			"label":              label,
+			"group_id":           1,
+			"assessment_type_id": assessmentType.Radio,
+			"group_key":          "answer",
+			"key":                "yes",
+		}},
+	}
+	tieBody := gin.H{"batch_id": other.Batch.ID, "markup_type_id": own.MarkupType.ID}
+	for k, v := range markupTypeBody {
+		tieBody[k] = v
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+	}{
+		{"find batch", http.MethodGet, "/batches/%d", nil},
+		{"update batch", http.MethodPut, "/batches/%d", gin.H{"name": "renamed", "overlaps": 1, "priority": 1, "type_id": 1}},
+		{"set batch status", http.MethodPut, "/batches/%d/status", gin.H{"status_id": batchStatus.Paused}},
+		{"batch transitions", http.MethodGet, "/batches/%d/transitions", nil},
+		{"markup type history", http.MethodGet, "/batches/%d/markupTypes", nil},
+		{"markup type diff", http.MethodGet, "/batches/%d/markupTypes/diff", nil},
+		{"tie markup type", http.MethodPost, "/batches/%d/markupTypes", tieBody},
+		{"clone batch", http.MethodPost, "/batches/%d/clone", gin.H{}},
+		{"export batch", http.MethodGet, "/batches/%d/export", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, fmt.Sprintf(tt.path, other.Batch.ID), tt.body)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	byID := []struct {
+		name   string
+		method string
+		path   string
+		id     uint
+		body   any
+	}{
+		{"find markup type", http.MethodGet, "/markupTypes/%d", other.MarkupType.ID, nil},
+		{"export markup type", http.MethodGet, "/markupTypes/%d/template", other.MarkupType.ID, nil},
+		{"update markup type", http.MethodPut, "/markupTypes/%d", other.MarkupType.ID, markupTypeBody},
+		{"delete markup type", http.MethodDelete, "/markupTypes/%d", other.MarkupType.ID, nil},
+		{"find markup", http.MethodGet, "/markups/%d", other.Markup.ID, nil},
+		{"find assessment", http.MethodGet, "/assessments/%d", other.Assessment.ID, nil},
+		{"assessment revisions", http.MethodGet, "/assessments/%d/revisions", other.Assessment.ID, nil},
+		{
+			"update assessment", http.MethodPut, "/assessments/%d", other.Assessment.ID,
+			gin.H{"fields": []gin.H{{"markup_type_field_id": other.MarkupType.Fields[0].ID}}},
+		},
+		{"delete assessment", http.MethodDelete, "/assessments/%d", other.Assessment.ID, nil},
+		{"store honeypot", http.MethodPost, "/honeypots/%d", other.Markup.ID, nil},
+	}
+	for _, tt := range byID {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, fmt.Sprintf(tt.path, tt.id), tt.body)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("other organization is left intact", func(t *testing.T) {
+		checks := []struct {
+			model any
+			id    uint
+		}{
+			{&models.Batch{}, other.Batch.ID},
+			{&models.MarkupType{}, other.MarkupType.ID},
+			{&models.Assessment{}, other.Assessment.ID},
+		}
+		for _, check := range checks {
+			if err := db.Where("id = ?", check.id).First(check.model).Error; err != nil {
+				t.Fatalf("%T %d: %v", check.model, check.id, err)
+			}
+		}
+
+		var batch models.Batch
+		db.Where("id = ?", other.Batch.ID).First(&batch)
+		if batch.Name != other.Batch.Name || batch.StatusID != other.Batch.StatusID {
+			t.Fatalf("batch of other organization was changed: %+v", batch)
+		}
+		var markupType models.MarkupType
+		db.Where("id = ?", other.MarkupType.ID).First(&markupType)
+		if markupType.Name != other.MarkupType.Name {
+			t.Fatalf("markup type of other organization was changed: %+v", markupType)
+		}
+		var count int64
+		db.Model(&models.Batch{}).Where("organization_id = ?", other.OrganizationID).Count(&count)
+		if count != 2 {
+			t.Fatalf("expected 2 batches of other organization, got %d", count)
+		}
+	})
+
+	ownReads := []struct {
+		name string
+		path string
+	}{
+		{"find own batch", fmt.Sprintf("/batches/%d", own.Batch.ID)},
+		{"own batch statistics", fmt.Sprintf("/batches/%d/markupTypes", own.Batch.ID)},
+		{"export own batch", fmt.Sprintf("/batches/%d/export", own.Batch.ID)},
+		{"find own markup type", fmt.Sprintf("/markupTypes/%d", own.MarkupType.ID)},
+		{"find own markup", fmt.Sprintf("/markups/%d", own.Markup.ID)},
+		{"find own assessment", fmt.Sprintf("/assessments/%d", own.Assessment.ID)},
+	}
+	for _, tt := range ownReads {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	lists := []struct {
+		name  string
+		path  string
+		owned []uint
+	}{
+		{"list batches", "/batches", []uint{own.Batch.ID}},
+		{"list markup types", "/markupTypes", []uint{own.MarkupType.ID}},
+		{"list markups", fmt.Sprintf("/markups?batch_id=%d", own.Batch.ID), []uint{own.Markup.ID}},
+		{"list markups of other batch", fmt.Sprintf("/markups?batch_id=%d", other.Batch.ID), nil},
+		{"list assessments", "/assessments", []uint{own.Assessment.ID}},
+		{"list honeypots", "/honeypots", []uint{own.Honeypot.ID}},
+	}
+	for _, tt := range lists {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			var res struct {
+				Data []struct {
+					ID uint `json:"id"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			ids := make([]uint, len(res.Data))
+			for i, item := range res.Data {
+				ids[i] = item.ID
+			}
+			if !slices.Equal(ids, tt.owned) {
+				t.Fatalf("expected %v, got %v", tt.owned, ids)
+			}
+		})
+	}
+}
+
+func TestCreateWithoutOrganization(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "client@example.com", nil, clientPermissions...)
+	r := newTestRouter(db, user)
+
+	label := "Yes"
+	w := serve(r, http.MethodPost, "/markupTypes", gin.H{
+		"name": "shared",
+		"fields": []gin.H{{
+			"name":               label,
+			"label":              label,
+			"group_id":           1,
+			"assessment_type_id": assessmentType.Radio,
+			"group_key":          "answer",
+			"key":                "yes",
+		}},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.MarkupType{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no markup types, got %d", count)
+	}
+}
@@ -0,0 +1,606 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log/slog"
+	"markup/internal/domain/models"
+	"markup/internal/lib/audit"
+	"markup/internal/lib/auth"
+	"markup/internal/lib/consensus"
+	"markup/internal/lib/ledger"
+	"markup/internal/lib/loginlimit"
+	"markup/internal/lib/password"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/validation/query"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type User struct {
+	log     *slog.Logger
+	db      *gorm.DB
+	limiter *loginlimit.Limiter
+	policy  password.Policy
+}
+
+func NewUser(
+	log *slog.Logger,
+	db *gorm.DB,
+	limiter *loginlimit.Limiter,
+	policy password.Policy,
+) *User {
+	return &User{
+		log:     log,
+		db:      db,
+		limiter: limiter,
+		policy:  policy,
+	}
+}
+
+// Index returns users with their roles. Users can be filtered by "email" substring and "role_id".
+func (con *User) Index(c *gin.Context) {
+	const op = "UserController.Index"
+	log := con.log.With(slog.String("op", op))
+
+	var page int
+	var perPage int
+	var err error
+
+	if page, err = query.DefaultInt(c, log, "page", "1"); err != nil {
+		return
+	}
+	if perPage, err = query.DefaultInt(c, log, "per_page", "10"); err != nil {
+		return
+	}
+	offset := (page - 1) * perPage
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if email := c.Query("email"); email != "" {
+			db = db.Where("email LIKE ?", "%"+email+"%")
+		}
+		if roleID := query.Int(c, "role_id"); roleID != nil {
+			db = db.Where("id IN (SELECT user_id FROM user_roles WHERE role_id = ?)", *roleID)
+		}
+		return db
+	}
+
+	var total int64
+	if err := con.db.Model(&models.User{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Error("failed to count users", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	var users []models.User
+	err = con.db.
+		Preload("Roles").
+		Scopes(filter).
+		Order("id").
+		Limit(perPage).
+		Offset(offset).
+		Find(&users).Error
+	if err != nil {
+		log.Error("failed to find users", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, responses.Pagination(users, total, page, perPage))
+}
+
+func (con *User) Find(c *gin.Context) {
+	const op = "UserController.Find"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+type storeUser struct {
+	Email          string `binding:"required,email" json:"email"`
+	Password       string `binding:"required" json:"password"`
+	OrganizationID *uint  `json:"organization_id"`
+	RoleIDs        []uint `binding:"required,min=1" json:"role_ids"`
+}
+
+func (con *User) Store(c *gin.Context) {
+	const op = "UserController.Store"
+	log := con.log.With(slog.String("op", op))
+
+	var data storeUser
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userRoles []models.Role
+	if !con.findRoles(c, log, &userRoles, data.RoleIDs) {
+		return
+	}
+
+	if err := con.policy.Validate(data.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{
+		Email:          data.Email,
+		Password:       string(passHash),
+		OrganizationID: data.OrganizationID,
+		CreatedAt:      time.Now(),
+		Roles:          userRoles,
+	}
+
+	var count int64
+	if err := con.db.Model(&models.User{}).Where("email = ?", data.Email).Count(&count).Error; err != nil {
+		log.Error("failed to check email", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already taken"})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Create, audit.User, user.ID, nil, user)
+	})
+	if err != nil {
+		log.Error("failed to create user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id": user.ID,
+	})
+}
+
+type updateUser struct {
+	Email          string `binding:"required,email" json:"email"`
+	OrganizationID *uint  `json:"organization_id"`
+}
+
+func (con *User) Update(c *gin.Context) {
+	const op = "UserController.Update"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data updateUser
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	var count int64
+	err := con.db.Model(&models.User{}).
+		Where("email = ? AND id != ?", data.Email, user.ID).
+		Count(&count).Error
+	if err != nil {
+		log.Error("failed to check email", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already taken"})
+		return
+	}
+
+	before := user
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]any{
+			"email":           data.Email,
+			"organization_id": data.OrganizationID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		user.Email = data.Email
+		user.OrganizationID = data.OrganizationID
+		return audit.Record(c, tx, audit.Update, audit.User, user.ID, before, user)
+	})
+	if err != nil {
+		log.Error("failed to update user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// Disable forbids user to sign in and revokes issued tokens. Unfinished assessments of user are released,
+// so that respective markups can be given to other assessors.
+func (con *User) Disable(c *gin.Context) {
+	const op = "UserController.Disable"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+	if con.isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot disable yourself"})
+		return
+	}
+
+	before := user
+	err := con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("is_disabled", true).Error; err != nil {
+			return err
+		}
+		if err := revokeTokens(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND hash IS NULL", user.ID).Delete(&models.Assessment{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Disable, audit.User, user.ID, before, user)
+	})
+	if err != nil {
+		log.Error("failed to disable user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (con *User) Enable(c *gin.Context) {
+	const op = "UserController.Enable"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	before := user
+	err := con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("is_disabled", false).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Enable, audit.User, user.ID, before, user)
+	})
+	if err != nil {
+		log.Error("failed to enable user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// Destroy deletes user that has no finished assessments. Users whose assessments take part in consensus
+// should be disabled instead.
+func (con *User) Destroy(c *gin.Context) {
+	const op = "UserController.Destroy"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+	if con.isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete yourself"})
+		return
+	}
+
+	var assessmentCount int64
+	err := con.db.Model(&models.Assessment{}).
+		Where("user_id = ? AND hash IS NOT NULL", user.ID).
+		Count(&assessmentCount).Error
+	if err != nil {
+		log.Error("failed to count assessments", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if assessmentCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user has assessments, disable the user instead"})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := audit.Record(c, tx, audit.Delete, audit.User, user.ID, user, nil); err != nil {
+			return err
+		}
+		var assessments []models.Assessment
+		if err := tx.Where("user_id = ?", user.ID).Find(&assessments).Error; err != nil {
+			return err
+		}
+		for _, assessment := range assessments {
+			if err := ledger.Reverse(tx, assessment.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Assessment{}).Error; err != nil {
+			return err
+		}
+		for _, assessment := range assessments {
+			if _, err := consensus.Recalculate(tx, assessment.MarkupID); err != nil {
+				return err
+			}
+		}
+		err := tx.Exec(
+			"DELETE FROM api_key_permissions WHERE api_key_id IN (SELECT id FROM api_keys WHERE user_id = ?)",
+			user.ID,
+		).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Association("Batches").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		log.Error("failed to delete user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+type assignRole struct {
+	RoleID uint `binding:"required" json:"role_id"`
+}
+
+func (con *User) AssignRole(c *gin.Context) {
+	const op = "UserController.AssignRole"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data assignRole
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+	var userRoles []models.Role
+	if !con.findRoles(c, log, &userRoles, []uint{data.RoleID}) {
+		return
+	}
+
+	err := con.db.Transaction(func(tx *gorm.DB) error {
+		before := user.Roles
+		if err := tx.Model(&user).Association("Roles").Append(userRoles); err != nil {
+			return err
+		}
+		return recordRoles(c, tx, audit.AssignRole, user, before)
+	})
+	if err != nil {
+		log.Error("failed to assign role", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (con *User) RevokeRole(c *gin.Context) {
+	const op = "UserController.RevokeRole"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	var role models.Role
+	if err := con.db.Where("id = ?", c.Param("role")).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("role not found")
+			responses.NotFoundError(c)
+			return
+		}
+
+		log.Error("failed to find role", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	err := con.db.Transaction(func(tx *gorm.DB) error {
+		before := user.Roles
+		if err := tx.Model(&user).Association("Roles").Delete(&role); err != nil {
+			return err
+		}
+		return recordRoles(c, tx, audit.RevokeRole, user, before)
+	})
+	if err != nil {
+		log.Error("failed to revoke role", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+type resetPassword struct {
+	Password string `binding:"required" json:"password"`
+}
+
+// ResetPassword sets new password of user.
+func (con *User) ResetPassword(c *gin.Context) {
+	const op = "UserController.ResetPassword"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var data resetPassword
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	if err := con.policy.Validate(data.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = con.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(passHash)).Error; err != nil {
+			return err
+		}
+		if err := revokeTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.ResetPassword, audit.User, user.ID, nil, nil)
+	})
+	if err != nil {
+		log.Error("failed to update password", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// Unlock lifts lockout caused by failed sign in attempts to account of user.
+func (con *User) Unlock(c *gin.Context) {
+	const op = "UserController.Unlock"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	if err := con.limiter.Unlock(c, user.Email); err != nil {
+		log.Error("failed to unlock user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+	if err := audit.Record(c, con.db, audit.Unlock, audit.User, user.ID, nil, nil); err != nil {
+		log.Error("failed to record audit log", slog.Any("error", err))
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// Logout revokes all tokens of user, forcing them to sign in again.
+func (con *User) Logout(c *gin.Context) {
+	const op = "UserController.Logout"
+	id := c.Param("id")
+	log := con.log.With(slog.String("op", op), slog.String("id", id))
+
+	var user models.User
+	if !con.find(c, log, &user, id) {
+		return
+	}
+
+	err := con.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.Logout, audit.User, user.ID, nil, nil)
+	})
+	if err != nil {
+		log.Error("failed to revoke tokens", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// recordRoles records change of roles of user to audit log. before are roles of user prior to the change.
+func recordRoles(c *gin.Context, tx *gorm.DB, action string, user models.User, before []models.Role) error {
+	var after []models.Role
+	if err := tx.Model(&user).Association("Roles").Find(&after); err != nil {
+		return err
+	}
+	return audit.Record(c, tx, action, audit.User, user.ID, gin.H{"roles": before}, gin.H{"roles": after})
+}
+
+// find loads user with roles by id and sends response if fails.
+func (con *User) find(c *gin.Context, log *slog.Logger, user *models.User, id string) bool {
+	if err := con.db.Preload("Roles").Where("id = ?", id).First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("user not found")
+			responses.NotFoundError(c)
+			return false
+		}
+
+		log.Error("failed to find user", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+	return true
+}
+
+// findRoles loads roles by ids and sends response if some of them do not exist.
+func (con *User) findRoles(c *gin.Context, log *slog.Logger, dest *[]models.Role, ids []uint) bool {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	if err := con.db.Where("id IN ?", ids).Find(dest).Error; err != nil {
+		log.Error("failed to find roles", slog.Any("error", err))
+		responses.InternalServerError(c)
+		return false
+	}
+	if len(*dest) != len(ids) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+		return false
+	}
+	return true
+}
+
+// isSelf reports whether user is the authenticated one.
+func (con *User) isSelf(c *gin.Context, user models.User) bool {
+	current, err := auth.User(c)
+	return err == nil && current.ID == user.ID
+}
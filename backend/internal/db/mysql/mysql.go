@@ -26,10 +26,16 @@ func New(host string, port int, user string, pass string, dbname string) (*gorm.
 	}
 
 	err = db.AutoMigrate(
-		&models.User{}, &models.Role{}, &models.Permission{},
+		&models.Organization{}, &models.User{}, &models.Role{}, &models.Permission{},
 		&models.Batch{}, &models.Markup{}, &models.MarkupType{},
 		&models.MarkupTypeField{}, &models.AssessmentType{},
 		&models.Assessment{}, &models.AssessmentField{},
+		&models.AssessmentSpan{}, &models.AssessmentBox{},
+		&models.MarkupTypeExample{}, &models.Invite{}, &models.RefreshToken{}, &models.APIKey{},
+		&models.LoginThrottle{}, &models.LoginAttempt{}, &models.PasswordReset{},
+		&models.AuditLog{}, &models.AssessmentRevision{},
+		&models.AssessmentInvalidation{}, &models.BatchTransition{},
+		&models.LedgerEntry{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
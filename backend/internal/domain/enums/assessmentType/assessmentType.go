@@ -6,4 +6,9 @@ const (
 	Select      = 3
 	Multiselect = 4
 	Text        = 5
+	Rating      = 6
+	Numeric     = 7
+	Range       = 8
+	Span        = 9
+	BoundingBox = 10
 )
@@ -0,0 +1,10 @@
+package batchStatus
+
+const (
+	Draft     = 1
+	Scheduled = 2
+	Active    = 3
+	Paused    = 4
+	Completed = 5
+	Archived  = 6
+)
@@ -0,0 +1,8 @@
+package jobStatus
+
+const (
+	Pending  = 1
+	Running  = 2
+	Finished = 3
+	Failed   = 4
+)
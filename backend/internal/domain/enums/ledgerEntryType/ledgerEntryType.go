@@ -0,0 +1,12 @@
+package ledgerEntryType
+
+// Credit is a price of assessment accepted by consensus.
+// Bonus is credited for correct assessment of honeypot.
+// Penalty is debited for assessment rejected by consensus.
+// Reversal cancels entries of assessment that was invalidated, deleted or whose outcome has changed after it was settled.
+const (
+	Credit   = 1
+	Bonus    = 2
+	Penalty  = 3
+	Reversal = 4
+)
@@ -0,0 +1,53 @@
+// Package permissions defines names of permissions that are checked by route middleware.
+package permissions
+
+const (
+	BatchRead   = "batch:read"
+	BatchCreate = "batch:create"
+	BatchUpdate = "batch:update"
+	BatchDelete = "batch:delete"
+	BatchExport = "batch:export"
+
+	MarkupTypeRead   = "markup_type:read"
+	MarkupTypeCreate = "markup_type:create"
+	MarkupTypeUpdate = "markup_type:update"
+	MarkupTypeDelete = "markup_type:delete"
+
+	MarkupRead = "markup:read"
+
+	// AssessmentCreate allows to set correct assessment of a markup.
+	AssessmentCreate = "assessment:create"
+	// AssessmentAssess allows to receive markups for assessment and to edit own recent assessments.
+	AssessmentAssess = "assessment:assess"
+	// AssessmentManage allows to edit assessments without time limit.
+	AssessmentManage = "assessment:manage"
+	AssessmentRead   = "assessment:read"
+	// AssessmentDelete allows to delete own recent assessments, or any assessment along with AssessmentManage.
+	AssessmentDelete = "assessment:delete"
+
+	HoneypotRead   = "honeypot:read"
+	HoneypotManage = "honeypot:manage"
+
+	UserRead = "user:read"
+	// UserManage allows to create, update, disable and delete users and to assign roles.
+	UserManage = "user:manage"
+
+	PermissionManage = "permission:manage"
+
+	// InviteCreate allows to invite users with roles and access to batches.
+	InviteCreate = "invite:create"
+
+	// APIKeyManage allows to create and revoke own API keys.
+	APIKeyManage = "api_key:manage"
+
+	// AuditRead allows to query audit log.
+	AuditRead = "audit:read"
+
+	// EarningsRead allows to see own earnings and balance.
+	EarningsRead = "earnings:read"
+	// PayoutExport allows to export payout reports of all users.
+	PayoutExport = "payout:export"
+
+	// TenantManage allows to access data of all organizations and to manage organizations.
+	TenantManage = "tenant:manage"
+)
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -8,14 +12,18 @@ import (
 )
 
 type User struct {
-	ID          uint         `json:"id" gorm:"primaryKey"`
-	Email       string       `json:"email" gorm:"unique;not null"`
-	Password    string       `json:"-" gorm:"not null"`
-	CreatedAt   time.Time    `json:"created_at"`
-	Roles       []Role       `json:"roles" gorm:"many2many:user_roles;"`
-	Permissions []Permission `json:"-" gorm:"many2many:user_permissions;"`
-	Batches     []Batch      `json:"-" gorm:"many2many:user_batches;"`
-	Assessments []Assessment `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	Email          string       `json:"email" gorm:"unique;not null"`
+	Password       string       `json:"-" gorm:"not null"`
+	OrganizationID *uint        `json:"organization_id" gorm:"null"`
+	IsDisabled     bool         `json:"is_disabled" gorm:"not null;default:false"`
+	TokenVersion   int          `json:"-" gorm:"not null;default:0"`
+	OIDCSubject    *string      `json:"-" gorm:"column:oidc_subject;unique"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Roles          []Role       `json:"roles" gorm:"many2many:user_roles;"`
+	Permissions    []Permission `json:"-" gorm:"many2many:user_permissions;"`
+	Batches        []Batch      `json:"-" gorm:"many2many:user_batches;"`
+	Assessments    []Assessment `json:"-" gorm:"foreignKey:UserID;references:ID"`
 }
 
 func (u User) HasRole(roleID uint) bool {
@@ -27,30 +35,196 @@ func (u User) HasRole(roleID uint) bool {
 	return false
 }
 
+// Can reports whether user is granted permission directly or through any of their roles.
+// Roles.Permissions and Permissions must be preloaded.
+func (u User) Can(permission string) bool {
+	for _, p := range u.Permissions {
+		if p.Name == permission {
+			return true
+		}
+	}
+	for _, role := range u.Roles {
+		for _, p := range role.Permissions {
+			if p.Name == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Organization is a tenant that owns batches and markup types. Client users can access only data of their organization.
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	Users     []User    `json:"-" gorm:"foreignKey:OrganizationID;references:ID"`
+}
+
+// Invite is a single-use code that allows to register with Role and access to Batches.
+// Only hash of the code is stored.
+type Invite struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	CodeHash       string     `json:"-" gorm:"unique;not null"`
+	RoleID         uint       `json:"role_id" gorm:"not null"`
+	OrganizationID *uint      `json:"organization_id" gorm:"null;index"`
+	CreatedByID    uint       `json:"created_by_id" gorm:"not null"`
+	UsedByID       *uint      `json:"used_by_id" gorm:"null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt         *time.Time `json:"used_at" gorm:"null"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Role           Role       `json:"role" gorm:"foreignKey:RoleID;references:ID"`
+	Batches        []Batch    `json:"batches" gorm:"many2many:invite_batches;"`
+}
+
+// RefreshToken allows to obtain new access token. Tokens are rotated on every use. Tokens issued one from another
+// share FamilyID, so that whole family is revoked when revoked token is used again.
+// Only hash of the token is stored.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash    string     `json:"-" gorm:"unique;not null"`
+	FamilyID     string     `json:"-" gorm:"not null;index"`
+	ReplacedByID *uint      `json:"replaced_by_id" gorm:"null"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revoked_at" gorm:"null"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// APIKey authenticates machine clients on behalf of User. Key grants only Permissions that are also granted to User.
+// Only hash of the key is stored, Prefix allows to tell keys apart.
+type APIKey struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	UserID      uint         `json:"user_id" gorm:"not null;index"`
+	Name        string       `json:"name" gorm:"not null"`
+	Prefix      string       `json:"prefix" gorm:"not null"`
+	KeyHash     string       `json:"-" gorm:"unique;not null"`
+	ExpiresAt   *time.Time   `json:"expires_at" gorm:"null"`
+	LastUsedAt  *time.Time   `json:"last_used_at" gorm:"null"`
+	RevokedAt   *time.Time   `json:"revoked_at" gorm:"null"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:api_key_permissions;"`
+}
+
+// JSON is a JSON document stored in text column. It is embedded into responses as is.
+type JSON string
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return []byte(j), nil
+}
+
+func (j *JSON) Scan(value any) error {
+	switch v := value.(type) {
+	case string:
+		*j = JSON(v)
+	case []byte:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("unsupported JSON value type %T", value)
+	}
+	return nil
+}
+
+func (j JSON) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+// AuditLog is an append-only record of change made by user. Before and After are JSON snapshots of the entity,
+// Before is null for created entities and After is null for deleted ones.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ActorID    *uint     `json:"actor_id" gorm:"null;index"`
+	APIKeyID   *uint     `json:"api_key_id" gorm:"null"`
+	Action     string    `json:"action" gorm:"not null;index"`
+	EntityType string    `json:"entity_type" gorm:"not null;index:idx_audit_logs_entity"`
+	EntityID   uint      `json:"entity_id" gorm:"not null;index:idx_audit_logs_entity"`
+	Before     *JSON     `json:"before" gorm:"type:text;null"`
+	After      *JSON     `json:"after" gorm:"type:text;null"`
+	IP         string    `json:"ip" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// PasswordReset is a single use token that allows user to set new password without knowing the current one.
+// Only hash of the token is stored.
+type PasswordReset struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"unique;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at" gorm:"null"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoginThrottle is a state of failed sign in attempts per client IP or account. It is used by Postgres store
+// of login limiter when application runs in multiple instances.
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey"`
+	Failures      int        `gorm:"not null;default:0"`
+	LastFailureAt time.Time  `gorm:"not null"`
+	LockedUntil   *time.Time `gorm:"null"`
+}
+
+// LoginAttempt records failed sign in attempt.
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"not null;index"`
+	IP        string    `json:"ip" gorm:"not null"`
+	Reason    string    `json:"reason" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
 type Role struct {
-	ID   uint   `json:"id" gorm:"primaryKey"`
-	Name string `json:"name" gorm:"unique;not null"`
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"unique;not null"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions;"`
 	//Users []User `gorm:"many2many:user_roles;"`
 }
 
 type Permission struct {
-	ID   uint   `gorm:"primaryKey"`
-	Name string `gorm:"unique;not null"`
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"unique;not null"`
 	//Users []User `gorm:"many2many:user_permissions;"`
 }
 
 type Batch struct {
-	ID          uint         `json:"id" gorm:"primaryKey"`
-	Name        string       `json:"name" gorm:"not null"`
-	Overlaps    int          `json:"overlaps"`
-	Priority    int          `json:"priority"`
-	CreatedAt   time.Time    `json:"created_at"`
-	IsActive    bool         `json:"is_active"`
-	TypeID      uint         `json:"type_id"`
-	IsHoneypot  bool         `json:"is_honeypot" gorm:"default:false"`
-	Markups     []Markup     `json:"-" gorm:"foreignKey:BatchID;references:ID"`
-	MarkupTypes []MarkupType `json:"-" gorm:"foreignKey:BatchID;references:ID"`
-	Users       []User       `json:"-" gorm:"many2many:user_batches;"`
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Overlaps  int       `json:"overlaps"`
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+	StatusID  uint      `json:"status_id" gorm:"not null;default:1;index"`
+	// StartsAt and EndsAt are times when scheduled batch is activated and active batch is paused automatically.
+	StartsAt        *time.Time `json:"starts_at" gorm:"null"`
+	EndsAt          *time.Time `json:"ends_at" gorm:"null"`
+	StatusChangedAt *time.Time `json:"status_changed_at" gorm:"null"`
+	// MaxAssessments limits total number of valid assessments of batch, MaxDailyAssessments limits number of
+	// assessments of batch made by single user per day (UTC). Markups of batch are not given after Deadline.
+	// Nil means no limit.
+	MaxAssessments      *int       `json:"max_assessments" gorm:"null"`
+	MaxDailyAssessments *int       `json:"max_daily_assessments" gorm:"null"`
+	Deadline            *time.Time `json:"deadline" gorm:"null"`
+	// Price is credited for assessment accepted by consensus and RejectionPenalty is debited for rejected one.
+	// HoneypotBonus is credited in addition to Price for correct assessment of honeypot batch.
+	// Amounts are in minor currency units.
+	Price            int64        `json:"price" gorm:"not null;default:0"`
+	HoneypotBonus    int64        `json:"honeypot_bonus" gorm:"not null;default:0"`
+	RejectionPenalty int64        `json:"rejection_penalty" gorm:"not null;default:0"`
+	TypeID           uint         `json:"type_id"`
+	IsHoneypot       bool         `json:"is_honeypot" gorm:"default:false"`
+	OrganizationID   *uint        `json:"organization_id" gorm:"null;index"`
+	Markups          []Markup     `json:"-" gorm:"foreignKey:BatchID;references:ID"`
+	MarkupTypes      []MarkupType `json:"-" gorm:"foreignKey:BatchID;references:ID"`
+	Users            []User       `json:"-" gorm:"many2many:user_batches;"`
+}
+
+// BatchTransition records change of status of Batch. ActorID is nil for transitions made by schedule.
+type BatchTransition struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	BatchID      uint      `json:"batch_id" gorm:"not null;index"`
+	FromStatusID uint      `json:"from_status_id"`
+	ToStatusID   uint      `json:"to_status_id"`
+	ActorID      *uint     `json:"actor_id" gorm:"null"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 //type UserBatch struct {
@@ -72,14 +246,58 @@ type Markup struct {
 }
 
 type MarkupType struct {
-	ID        uint              `gorm:"primaryKey" json:"id"`
-	BatchID   *uint             `gorm:"null" json:"batch_id"`
-	Name      string            `gorm:"not null" json:"name"`
-	ChildID   *uint             `gorm:"null" json:"child_id"`
-	UserID    *uint             `gorm:"null" json:"user_id"`
-	CreatedAt time.Time         `json:"created_at"`
-	Fields    []MarkupTypeField `gorm:"foreignKey:MarkupTypeID;references:ID;onDelete:CASCADE" json:"fields"`
-	Batch     Batch             `gorm:"foreignKey:BatchID;references:ID" json:"-"`
+	ID             uint                `gorm:"primaryKey" json:"id"`
+	BatchID        *uint               `gorm:"null" json:"batch_id"`
+	Name           string              `gorm:"not null" json:"name"`
+	Instructions   *string             `gorm:"type:text;null" json:"instructions"`
+	ChildID        *uint               `gorm:"null" json:"child_id"`
+	UserID         *uint               `gorm:"null" json:"user_id"`
+	OrganizationID *uint               `gorm:"null;index" json:"organization_id"`
+	CreatedAt      time.Time           `json:"created_at"`
+	Fields         []MarkupTypeField   `gorm:"foreignKey:MarkupTypeID;references:ID;onDelete:CASCADE" json:"fields"`
+	Examples       []MarkupTypeExample `gorm:"foreignKey:MarkupTypeID;references:ID" json:"examples"`
+	Batch          Batch               `gorm:"foreignKey:BatchID;references:ID" json:"-"`
+}
+
+// Copy returns markup type settings, fields and examples without identifiers,
+// so that it can be used as a new version of MarkupType.
+func (mt MarkupType) Copy() MarkupType {
+	fields := make([]MarkupTypeField, len(mt.Fields))
+	for i, field := range mt.Fields {
+		fields[i] = field.Copy()
+	}
+	examples := make([]MarkupTypeExample, len(mt.Examples))
+	for i, example := range mt.Examples {
+		examples[i] = example.Copy()
+	}
+
+	return MarkupType{
+		Name:         mt.Name,
+		Instructions: mt.Instructions,
+		Fields:       fields,
+		Examples:     examples,
+	}
+}
+
+// MarkupTypeExample is a worked example of assessment shown to assessors along with MarkupType instructions.
+// Positive examples show how Markup should be assessed, negative ones show common mistakes.
+type MarkupTypeExample struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	MarkupTypeID uint       `json:"markup_type_id"`
+	MarkupID     uint       `json:"markup_id"`
+	IsPositive   bool       `json:"is_positive"`
+	Comment      *string    `gorm:"type:text;null" json:"comment"`
+	MarkupType   MarkupType `gorm:"foreignKey:MarkupTypeID;references:ID" json:"-"`
+	Markup       Markup     `gorm:"foreignKey:MarkupID;references:ID" json:"markup"`
+}
+
+// Copy returns example without identifiers, so that it can be attached to another MarkupType.
+func (e MarkupTypeExample) Copy() MarkupTypeExample {
+	return MarkupTypeExample{
+		MarkupID:   e.MarkupID,
+		IsPositive: e.IsPositive,
+		Comment:    e.Comment,
+	}
 }
 
 type MarkupTypeField struct {
@@ -88,48 +306,265 @@ type MarkupTypeField struct {
 	AssessmentTypeID uint           `json:"assessment_type_id"`
 	Name             *string        `gorm:"null" json:"name"`
 	Label            *string        `gorm:"null" json:"label"`
+	HelpText         *string        `gorm:"type:text;null" json:"help_text"`
 	GroupID          uint           `json:"group_id"`
+	GroupKey         string         `gorm:"not null;default:''" json:"group_key"`
+	Key              string         `gorm:"not null;default:''" json:"key"`
+	Position         int            `gorm:"default:0" json:"position"`
+	Color            *string        `gorm:"null" json:"color"`
+	Hotkey           *string        `gorm:"null" json:"hotkey"`
+	IsDefault        bool           `gorm:"default:false" json:"is_default"`
+	IsRequired       bool           `gorm:"default:false" json:"is_required"`
+	MinLength        *int           `gorm:"null" json:"min_length"`
+	MaxLength        *int           `gorm:"null" json:"max_length"`
+	Pattern          *string        `gorm:"null" json:"pattern"`
+	Min              *float64       `gorm:"null" json:"min"`
+	Max              *float64       `gorm:"null" json:"max"`
+	Step             *float64       `gorm:"null" json:"step"`
 	MarkupType       MarkupType     `gorm:"foreignKey:MarkupTypeID;references:ID" json:"-"`
 	AssessmentType   AssessmentType `gorm:"foreignKey:AssessmentTypeID;references:ID" json:"assessment_type"`
 }
 
+// FullKey returns stable machine key of the field in form "group_key.key".
+func (f MarkupTypeField) FullKey() string {
+	return f.GroupKey + "." + f.Key
+}
+
+// Copy returns field settings without identifiers, so that field can be attached to another MarkupType.
+func (f MarkupTypeField) Copy() MarkupTypeField {
+	return MarkupTypeField{
+		AssessmentTypeID: f.AssessmentTypeID,
+		Name:             f.Name,
+		Label:            f.Label,
+		HelpText:         f.HelpText,
+		GroupID:          f.GroupID,
+		GroupKey:         f.GroupKey,
+		Key:              f.Key,
+		Position:         f.Position,
+		Color:            f.Color,
+		Hotkey:           f.Hotkey,
+		IsDefault:        f.IsDefault,
+		IsRequired:       f.IsRequired,
+		MinLength:        f.MinLength,
+		MaxLength:        f.MaxLength,
+		Pattern:          f.Pattern,
+		Min:              f.Min,
+		Max:              f.Max,
+		Step:             f.Step,
+	}
+}
+
 type AssessmentType struct {
 	ID   uint   `gorm:"primaryKey" json:"id"`
 	Name string `gorm:"not null" json:"name"`
 }
 
 type Assessment struct {
-	ID        uint              `json:"id" gorm:"primaryKey"`
-	UserID    uint              `json:"user_id"`
-	MarkupID  uint              `json:"markup_id"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt *time.Time        `json:"updated_at" gorm:"autoUpdateTime"`
-	IsPrior   bool              `json:"is_prior"`
-	Hash      *string           `json:"hash"`
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id"`
+	MarkupID  uint       `json:"markup_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	IsPrior   bool       `json:"is_prior"`
+	Hash      *string    `json:"hash"`
+	// InvalidatedAt is set when Assessment is discarded by AssessmentInvalidation. Invalidated assessments
+	// do not take part in consensus and statistics.
+	InvalidatedAt  *time.Time `json:"invalidated_at" gorm:"null;index"`
+	InvalidationID *uint      `json:"invalidation_id" gorm:"null"`
+	// SettledAt is set when earnings of Assessment are recorded in ledger and cleared when they are reversed.
+	SettledAt *time.Time        `json:"settled_at" gorm:"null;index"`
 	Fields    []AssessmentField `json:"fields" gorm:"foreignKey:AssessmentID;references:ID"`
 	User      User              `json:"-" gorm:"foreignKey:UserID;references:ID"`
 	Markup    Markup            `json:"-" gorm:"foreignKey:MarkupID;references:ID"`
 }
 
+// CalculateHash builds consensus key of Assessment from selected MarkupTypeField ids.
+// Fields that carry values (numbers, spans, boxes) add their normalized value to respective id,
+// so that assessments are considered identical only if values match.
 func (a Assessment) CalculateHash() string {
-	ids := make([]uint, len(a.Fields))
-	for i, field := range a.Fields {
-		ids[i] = field.MarkupTypeFieldID
-	}
-	slices.Sort(ids)
+	fields := slices.Clone(a.Fields)
+	slices.SortFunc(fields, func(a, b AssessmentField) int {
+		return cmp.Compare(a.MarkupTypeFieldID, b.MarkupTypeFieldID)
+	})
 
-	idsString := make([]string, len(ids))
-	for i, id := range ids {
-		idsString[i] = strconv.Itoa(int(id))
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = strconv.Itoa(int(field.MarkupTypeFieldID)) + field.hashValue()
 	}
-	return strings.Join(idsString, ",")
+	return strings.Join(parts, ",")
+}
+
+// AssessmentInvalidation is a background job that invalidates finished assessments of user, optionally made
+// within [From, To) or in given batches, and recalculates consensus of affected markups.
+type AssessmentInvalidation struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	UserID             uint       `json:"user_id" gorm:"not null;index"`
+	CreatedByID        uint       `json:"created_by_id" gorm:"not null"`
+	From               *time.Time `json:"from" gorm:"null"`
+	To                 *time.Time `json:"to" gorm:"null"`
+	StatusID           uint       `json:"status_id" gorm:"not null;index"`
+	AssessmentCount    int        `json:"assessment_count"`
+	MarkupCount        int        `json:"markup_count"`
+	ChangedMarkupCount int        `json:"changed_markup_count"`
+	Error              *string    `json:"error" gorm:"type:text;null"`
+	CreatedAt          time.Time  `json:"created_at"`
+	FinishedAt         *time.Time `json:"finished_at" gorm:"null"`
+	Batches            []Batch    `json:"batches" gorm:"many2many:assessment_invalidation_batches;"`
+}
+
+// LedgerEntry is a credit or debit of earnings of user for Assessment. Entries are never changed,
+// corrections are recorded as new entries. Assessment is settled again after reversal of its entries.
+type LedgerEntry struct {
+	ID           uint `json:"id" gorm:"primaryKey"`
+	UserID       uint `json:"user_id" gorm:"not null;index"`
+	AssessmentID uint `json:"assessment_id" gorm:"not null;index"`
+	BatchID      uint `json:"batch_id" gorm:"not null;index"`
+	TypeID       uint `json:"type_id" gorm:"not null"`
+	// Amount is in minor currency units, negative for debits.
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// AssessmentRevision is a state of Assessment after it was created, updated or restored. Revisions of Assessment
+// are numbered from 1. Fields is a JSON snapshot of fields in the format they are submitted in.
+type AssessmentRevision struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	AssessmentID   uint      `json:"assessment_id" gorm:"not null;uniqueIndex:idx_assessment_revisions_number"`
+	Number         int       `json:"number" gorm:"not null;uniqueIndex:idx_assessment_revisions_number"`
+	UserID         uint      `json:"user_id" gorm:"not null"`
+	Hash           *string   `json:"hash" gorm:"null"`
+	Fields         JSON      `json:"fields" gorm:"type:text;not null"`
+	RestoredFromID *uint     `json:"restored_from_id" gorm:"null"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 type AssessmentField struct {
-	ID                uint            `json:"id" gorm:"primaryKey"`
-	AssessmentID      uint            `json:"assessment_id"`
-	MarkupTypeFieldID uint            `json:"markup_type_field_id"`
-	Text              *string         `json:"text"`
-	Assessment        Assessment      `json:"-" gorm:"foreignKey:AssessmentID;references:ID"`
-	MarkupTypeField   MarkupTypeField `json:"markup_type_field" gorm:"foreignKey:MarkupTypeFieldID;references:ID"`
+	ID                uint             `json:"id" gorm:"primaryKey"`
+	AssessmentID      uint             `json:"assessment_id"`
+	MarkupTypeFieldID uint             `json:"markup_type_field_id"`
+	Text              *string          `json:"text"`
+	Number            *float64         `json:"number" gorm:"null"`
+	NumberTo          *float64         `json:"number_to" gorm:"null"`
+	Spans             []AssessmentSpan `json:"spans" gorm:"foreignKey:AssessmentFieldID;references:ID"`
+	Boxes             []AssessmentBox  `json:"boxes" gorm:"foreignKey:AssessmentFieldID;references:ID"`
+	Assessment        Assessment       `json:"-" gorm:"foreignKey:AssessmentID;references:ID"`
+	MarkupTypeField   MarkupTypeField  `json:"markup_type_field" gorm:"foreignKey:MarkupTypeFieldID;references:ID"`
+}
+
+// Copy returns field value without identifiers, so that it can be attached to another Assessment.
+func (f AssessmentField) Copy() AssessmentField {
+	spans := make([]AssessmentSpan, len(f.Spans))
+	for i, span := range f.Spans {
+		spans[i] = AssessmentSpan{Column: span.Column, Start: span.Start, End: span.End}
+	}
+	boxes := make([]AssessmentBox, len(f.Boxes))
+	for i, box := range f.Boxes {
+		boxes[i] = AssessmentBox{X: box.X, Y: box.Y, Width: box.Width, Height: box.Height}
+	}
+
+	return AssessmentField{
+		MarkupTypeFieldID: f.MarkupTypeFieldID,
+		Text:              f.Text,
+		Number:            f.Number,
+		NumberTo:          f.NumberTo,
+		Spans:             spans,
+		Boxes:             boxes,
+	}
+}
+
+// Value returns human-readable representation of field value. Is used in exports.
+func (f AssessmentField) Value() string {
+	switch {
+	case f.Number != nil && f.NumberTo != nil:
+		return formatNumber(*f.Number) + ".." + formatNumber(*f.NumberTo)
+	case f.Number != nil:
+		return formatNumber(*f.Number)
+	case len(f.Spans) > 0:
+		parts := make([]string, len(f.sortedSpans()))
+		for i, span := range f.sortedSpans() {
+			parts[i] = span.String()
+		}
+		return strings.Join(parts, ";")
+	case len(f.Boxes) > 0:
+		parts := make([]string, len(f.sortedBoxes()))
+		for i, box := range f.sortedBoxes() {
+			parts[i] = box.String()
+		}
+		return strings.Join(parts, ";")
+	}
+	return ""
+}
+
+// hashValue returns value suffix of AssessmentField that is used in Assessment.CalculateHash.
+// Fields without value return empty string to keep hashes of choice fields unchanged.
+// Separator of hash parts is escaped in value, so that values can not be confused with other parts.
+func (f AssessmentField) hashValue() string {
+	value := f.Value()
+	if value == "" {
+		return ""
+	}
+	return "=" + hashEscaper.Replace(value)
+}
+
+var hashEscaper = strings.NewReplacer("%", "%25", ",", "%2C")
+
+func (f AssessmentField) sortedSpans() []AssessmentSpan {
+	spans := slices.Clone(f.Spans)
+	slices.SortFunc(spans, func(a, b AssessmentSpan) int {
+		return cmp.Or(cmp.Compare(a.Column, b.Column), cmp.Compare(a.Start, b.Start), cmp.Compare(a.End, b.End))
+	})
+	return spans
+}
+
+// sortedBoxes returns boxes rounded to 2 decimal places and sorted by rounded coordinates, so that order of
+// almost identical boxes does not depend on insignificant digits.
+func (f AssessmentField) sortedBoxes() []AssessmentBox {
+	boxes := slices.Clone(f.Boxes)
+	for i, box := range boxes {
+		boxes[i] = box.rounded()
+	}
+	slices.SortFunc(boxes, func(a, b AssessmentBox) int {
+		return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y), cmp.Compare(a.Width, b.Width), cmp.Compare(a.Height, b.Height))
+	})
+	return boxes
+}
+
+// AssessmentSpan is a character range [Start, End) of Markup.Data column highlighted by assessor.
+type AssessmentSpan struct {
+	ID                uint   `json:"id" gorm:"primaryKey"`
+	AssessmentFieldID uint   `json:"assessment_field_id"`
+	Column            string `json:"column" gorm:"not null"`
+	Start             int    `json:"start"`
+	End               int    `json:"end"`
+}
+
+func (s AssessmentSpan) String() string {
+	return fmt.Sprintf("%s[%d:%d]", s.Column, s.Start, s.End)
+}
+
+// AssessmentBox is a rectangle on an image with coordinates normalized to [0, 1] relative to image size.
+type AssessmentBox struct {
+	ID                uint    `json:"id" gorm:"primaryKey"`
+	AssessmentFieldID uint    `json:"assessment_field_id"`
+	X                 float64 `json:"x"`
+	Y                 float64 `json:"y"`
+	Width             float64 `json:"width"`
+	Height            float64 `json:"height"`
+}
+
+// String returns box coordinates rounded to 2 decimal places, so that almost identical boxes are considered equal.
+func (b AssessmentBox) String() string {
+	return fmt.Sprintf("%.2f,%.2f,%.2f,%.2f", b.X, b.Y, b.Width, b.Height)
+}
+
+func (b AssessmentBox) rounded() AssessmentBox {
+	round := func(n float64) float64 {
+		return math.Round(n*100) / 100
+	}
+	b.X, b.Y, b.Width, b.Height = round(b.X), round(b.Y), round(b.Width), round(b.Height)
+	return b
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
 }
@@ -0,0 +1,101 @@
+// Package audit appends records of changes made by users to audit log.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"markup/internal/domain/models"
+	"time"
+)
+
+// Entity types.
+const (
+	Batch      = "batch"
+	MarkupType = "markup_type"
+	Assessment = "assessment"
+	// Markup is recorded when correct assessment of markup is set.
+	Markup   = "markup"
+	Honeypot = "honeypot"
+	User     = "user"
+	// AssessmentInvalidation entries refer to models.AssessmentInvalidation jobs.
+	AssessmentInvalidation = "assessment_invalidation"
+)
+
+// Actions.
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+	Import = "import"
+	// Clone records batch created as a copy of another one.
+	Clone   = "clone"
+	Restore = "restore"
+	Tie     = "tie_markup_type"
+	// Transition records change of status of batch.
+	Transition = "transition"
+	// SetCorrect records previous and new prior assessment and correct assessment hash of markup.
+	SetCorrect = "set_correct"
+	Disable    = "disable"
+	Enable     = "enable"
+	// AssignRole and RevokeRole record before and after role lists of user.
+	AssignRole    = "assign_role"
+	RevokeRole    = "revoke_role"
+	ResetPassword = "reset_password"
+	Logout        = "logout"
+	Unlock        = "unlock"
+	// Invalidate records created models.AssessmentInvalidation job.
+	Invalidate = "invalidate"
+)
+
+// Record appends entry to audit log. Actor is taken from authenticated request. before and after are stored as JSON,
+// nil is stored as null. db should be a transaction of the change, so that entry is kept only if change is committed.
+func Record(c *gin.Context, db *gorm.DB, action string, entityType string, entityID uint, before any, after any) error {
+	const op = "audit.Record"
+
+	entry := models.AuditLog{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IP:         c.ClientIP(),
+		CreatedAt:  time.Now(),
+	}
+
+	if user, ok := c.Get("user"); ok {
+		if user, ok := user.(models.User); ok {
+			entry.ActorID = &user.ID
+		}
+	}
+	if apiKey, ok := c.Get("api_key"); ok {
+		if apiKey, ok := apiKey.(models.APIKey); ok {
+			entry.APIKeyID = &apiKey.ID
+		}
+	}
+
+	var err error
+	if entry.Before, err = marshal(before); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if entry.After, err = marshal(after); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func marshal(value any) (*models.JSON, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	res := models.JSON(b)
+	return &res, nil
+}
@@ -22,3 +22,9 @@ func User(c *gin.Context) (models.User, error) {
 
 	return userObj, nil
 }
+
+// IsAPIKey reports whether request is authenticated with models.APIKey instead of access token.
+func IsAPIKey(c *gin.Context) bool {
+	_, exists := c.Get("api_key")
+	return exists
+}
@@ -0,0 +1,86 @@
+// Package consensus decides correct assessment of markup from assessments made for it.
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/enums/markupStatus"
+	"markup/internal/domain/models"
+	"markup/internal/lib/ledger"
+	"markup/internal/lib/lifecycle"
+)
+
+// Recalculate sets status and correct assessment hash of models.Markup from its current valid assessments.
+// Prior assessment defines correct answer. Otherwise, the most common hash is correct once it is given by
+// models.Batch Overlaps assessments, and markup returns to pending if no hash has enough assessments.
+// Earnings of assessments that were already settled are corrected if their outcome has changed, see ledger.Resettle.
+// Completed batch is reopened when its markup returns to pending, so that markup can be assessed again.
+// Reports whether status of markup has changed.
+func Recalculate(tx *gorm.DB, markupID uint) (bool, error) {
+	const op = "consensus.Recalculate"
+
+	var markup models.Markup
+	if err := tx.Preload("Batch").Where("id = ?", markupID).First(&markup).Error; err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var statusID uint = markupStatus.Pending
+	var correctHash *string
+
+	var prior models.Assessment
+	err := tx.
+		Where("markup_id = ? AND is_prior IS TRUE AND hash IS NOT NULL AND invalidated_at IS NULL", markupID).
+		First(&prior).Error
+	switch {
+	case err == nil:
+		statusID = markupStatus.Processed
+		correctHash = prior.Hash
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var top struct {
+			Hash  string
+			Count int64
+		}
+		err := tx.Model(&models.Assessment{}).
+			Select("hash, COUNT(*) AS count").
+			Where("markup_id = ? AND hash IS NOT NULL AND invalidated_at IS NULL", markupID).
+			Group("hash").
+			Order("count DESC, MIN(id)").
+			Limit(1).
+			Scan(&top).Error
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+		if top.Count > 0 && top.Count >= int64(markup.Batch.Overlaps) {
+			statusID = markupStatus.Processed
+			correctHash = &top.Hash
+		}
+	default:
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Model(&models.Markup{}).
+		Where("id = ?", markupID).
+		Updates(map[string]any{
+			"status_id":               statusID,
+			"correct_assessment_hash": correctHash,
+		}).Error
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := ledger.ResettleMarkup(tx, markupID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	batch := markup.Batch
+	if statusID == markupStatus.Pending && batch.StatusID == batchStatus.Completed && !batch.IsHoneypot {
+		err := lifecycle.Transition(tx, &batch, batchStatus.Active, nil)
+		if err != nil && !errors.Is(err, lifecycle.ErrStatusChanged) {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return statusID != markup.StatusID, nil
+}
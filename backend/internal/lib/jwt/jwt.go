@@ -1,32 +1,184 @@
+// Package jwt issues and validates access tokens. Tokens are signed with one of the keys of KeySet
+// identified by "kid" header, so that keys can be rotated without invalidating issued tokens.
 package jwt
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
+// AccessTTL is a lifetime of access token. Access tokens are renewed with refresh tokens.
+const AccessTTL = 15 * time.Minute
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// HMACKeyID is an id of the key that is created from shared secret when no other keys are configured.
+const HMACKeyID = "hmac"
+
+var (
+	ErrUnknownKey        = errors.New("unknown signing key")
+	ErrExpiredKey        = errors.New("signing key is expired")
+	ErrUnsupportedAlg    = errors.New("unsupported signing algorithm")
+	ErrActiveKeyNotFound = errors.New("active key is not found")
+)
+
 type Claims struct {
 	UserID uint `json:"user_id"`
+	// TokenVersion must match models.User TokenVersion. Incrementing the latter revokes all issued tokens.
+	TokenVersion int `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, jwtSecret string) (string, error) {
+// Key is a signing key. Secret is []byte for HS256, *rsa.PrivateKey for RS256 and ed25519.PrivateKey for EdDSA.
+// Tokens signed with the key are rejected after ExpiresAt.
+type Key struct {
+	ID        string
+	Algorithm string
+	Secret    any
+	ExpiresAt *time.Time
+}
+
+func (k Key) isExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+func (k Key) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case RS256:
+		return jwt.SigningMethodRS256
+	case EdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// verificationKey returns key that verifies signatures made with the key.
+func (k Key) verificationKey() any {
+	if signer, ok := k.Secret.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return k.Secret
+}
+
+// LoadKey reads PEM encoded private key from path. Secret of HS256 key is read as is.
+func LoadKey(id string, algorithm string, path string, expiresAt *time.Time) (Key, error) {
+	const op = "jwt.LoadKey"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := Key{
+		ID:        id,
+		Algorithm: algorithm,
+		ExpiresAt: expiresAt,
+	}
+	switch algorithm {
+	case HS256:
+		key.Secret = data
+	case RS256:
+		key.Secret, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case EdDSA:
+		key.Secret, err = jwt.ParseEdPrivateKeyFromPEM(data)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedAlg, algorithm)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: key %s: %w", op, id, err)
+	}
+
+	return key, nil
+}
+
+// KeySet signs tokens with active key and validates tokens signed with any of its keys.
+type KeySet struct {
+	keys   map[string]Key
+	active string
+}
+
+// NewKeySet creates KeySet that signs tokens with key identified by active.
+func NewKeySet(active string, keys ...Key) (*KeySet, error) {
+	const op = "jwt.NewKeySet"
+
+	ks := &KeySet{
+		keys:   make(map[string]Key, len(keys)),
+		active: active,
+	}
+	for _, key := range keys {
+		ks.keys[key.ID] = key
+	}
+	if _, ok := ks.keys[active]; !ok {
+		return nil, fmt.Errorf("%s: %w: %s", op, ErrActiveKeyNotFound, active)
+	}
+
+	return ks, nil
+}
+
+// NewHMACKeySet creates KeySet with single HS256 key made of shared secret.
+func NewHMACKeySet(secret string) *KeySet {
+	key := Key{ID: HMACKeyID, Algorithm: HS256, Secret: []byte(secret)}
+	return &KeySet{
+		keys:   map[string]Key{key.ID: key},
+		active: key.ID,
+	}
+}
+
+func (ks *KeySet) GenerateToken(userID uint, tokenVersion int) (string, error) {
+	const op = "jwt.GenerateToken"
+
+	key := ks.keys[ks.active]
+	if key.isExpired() {
+		return "", fmt.Errorf("%s: %w: %s", op, ErrExpiredKey, key.ID)
+	}
+
 	claims := &Claims{
-		UserID: userID,
+		UserID:       userID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expires in 24 hours
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "markups",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
 }
 
-func ValidateToken(tokenString, jwtSecret string) (*Claims, error) {
+// ValidateToken checks token signature with the key identified by "kid" header.
+// Tokens signed with unknown or expired keys or with algorithm other than algorithm of the key are rejected.
+func (ks *KeySet) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if key.isExpired() {
+			return nil, ErrExpiredKey
+		}
+		if token.Method.Alg() != key.method().Alg() {
+			return nil, ErrUnsupportedAlg
+		}
+		return key.verificationKey(), nil
 	})
 
 	if err != nil {
@@ -39,3 +191,49 @@ func ValidateToken(tokenString, jwtSecret string) (*Claims, error) {
 
 	return nil, jwt.ErrSignatureInvalid
 }
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns public keys of not expired asymmetric keys. HS256 keys are never published.
+func (ks *KeySet) JWKS() []JWK {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	res := make([]JWK, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		if key.isExpired() {
+			continue
+		}
+
+		jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+		switch public := key.verificationKey().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encode(public.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encode(public)
+		default:
+			continue
+		}
+		res = append(res, jwk)
+	}
+	slices.SortFunc(res, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+
+	return res
+}
@@ -0,0 +1,200 @@
+// Package ledger records earnings of assessors for their assessments.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"markup/internal/domain/enums/ledgerEntryType"
+	"markup/internal/domain/enums/markupStatus"
+	"markup/internal/domain/models"
+	"time"
+)
+
+// outcome reports whether assessment is accepted by consensus and whether it can be settled at all.
+// assessment must be loaded with Markup.Batch.
+func outcome(assessment models.Assessment) (accepted bool, ok bool) {
+	markup := assessment.Markup
+
+	if assessment.IsPrior || assessment.Hash == nil || assessment.InvalidatedAt != nil {
+		return false, false
+	}
+	if markup.CorrectAssessmentHash == nil {
+		return false, false
+	}
+	// Markups of honeypots stay pending, their correct assessment is known from the start.
+	if !markup.Batch.IsHoneypot && markup.StatusID != markupStatus.Processed {
+		return false, false
+	}
+	return *assessment.Hash == *markup.CorrectAssessmentHash, true
+}
+
+// Settle records earnings for finished assessment once its markup has correct assessment.
+// Assessment accepted by consensus is credited with price of batch, rejected one is debited with penalty.
+// Correct assessment of honeypot is credited with bonus as well. Zero bonus and penalty are not recorded.
+// assessment must be loaded with Markup.Batch. Reports whether assessment was settled, assessment that is
+// already settled is left as is.
+func Settle(tx *gorm.DB, assessment models.Assessment) (bool, error) {
+	const op = "ledger.Settle"
+
+	batch := assessment.Markup.Batch
+
+	accepted, ok := outcome(assessment)
+	if !ok {
+		return false, nil
+	}
+
+	entry := func(typeID uint, amount int64) models.LedgerEntry {
+		return models.LedgerEntry{
+			UserID:       assessment.UserID,
+			AssessmentID: assessment.ID,
+			BatchID:      batch.ID,
+			TypeID:       typeID,
+			Amount:       amount,
+			CreatedAt:    time.Now(),
+		}
+	}
+
+	// Assessment is marked as settled first, so that concurrent settlement of the same assessment records
+	// no entries.
+	result := tx.Model(&models.Assessment{}).
+		Where("id = ? AND settled_at IS NULL", assessment.ID).
+		UpdateColumn("settled_at", time.Now())
+	if err := result.Error; err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	// Credit is recorded even if price is zero, it tells that assessment was accepted.
+	var entries []models.LedgerEntry
+	if accepted {
+		entries = append(entries, entry(ledgerEntryType.Credit, batch.Price))
+		if batch.IsHoneypot && batch.HoneypotBonus != 0 {
+			entries = append(entries, entry(ledgerEntryType.Bonus, batch.HoneypotBonus))
+		}
+	} else if batch.RejectionPenalty != 0 {
+		entries = append(entries, entry(ledgerEntryType.Penalty, -batch.RejectionPenalty))
+	}
+
+	if len(entries) > 0 {
+		if err := tx.Create(&entries).Error; err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return true, nil
+}
+
+// Reverse records entry that cancels earnings of assessment since its last reversal, so that assessment
+// can be settled again.
+func Reverse(tx *gorm.DB, assessmentID uint) error {
+	const op = "ledger.Reverse"
+
+	var entries []models.LedgerEntry
+	err := tx.Scopes(sinceReversal(assessmentID)).Order("id").Find(&entries).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Reversal is recorded even if total is zero, it tells that entries before it are cancelled.
+	if len(entries) > 0 {
+		var total int64
+		for _, entry := range entries {
+			total += entry.Amount
+		}
+
+		reversal := models.LedgerEntry{
+			UserID:       entries[0].UserID,
+			AssessmentID: assessmentID,
+			BatchID:      entries[0].BatchID,
+			TypeID:       ledgerEntryType.Reversal,
+			Amount:       -total,
+			CreatedAt:    time.Now(),
+		}
+		if err := tx.Create(&reversal).Error; err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = tx.Model(&models.Assessment{}).
+		Where("id = ?", assessmentID).
+		UpdateColumn("settled_at", nil).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Resettle corrects earnings of settled assessment whose outcome has changed since it was settled. Earnings are
+// reversed and assessment is settled again with its current outcome. Assessment that can not be settled anymore
+// stays reversed until it is settled by schedule.
+func Resettle(tx *gorm.DB, assessmentID uint) error {
+	const op = "ledger.Resettle"
+
+	var assessment models.Assessment
+	err := tx.Preload("Markup.Batch").Where("id = ?", assessmentID).First(&assessment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Reverse(tx, assessmentID)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if assessment.SettledAt == nil {
+		return nil
+	}
+
+	var credits int64
+	err = tx.Model(&models.LedgerEntry{}).
+		Scopes(sinceReversal(assessmentID)).
+		Where("type_id = ?", ledgerEntryType.Credit).
+		Count(&credits).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	accepted, ok := outcome(assessment)
+	if ok && accepted == (credits > 0) {
+		return nil
+	}
+
+	if err := Reverse(tx, assessmentID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := Settle(tx, assessment); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ResettleMarkup corrects earnings of settled assessments of markup, see Resettle.
+func ResettleMarkup(tx *gorm.DB, markupID uint) error {
+	const op = "ledger.ResettleMarkup"
+
+	var ids []uint
+	err := tx.Model(&models.Assessment{}).
+		Where("markup_id = ? AND settled_at IS NOT NULL", markupID).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, id := range ids {
+		if err := Resettle(tx, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// sinceReversal limits ledger entries to entries of assessment recorded after its last reversal.
+func sinceReversal(assessmentID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where("assessment_id = ?", assessmentID).
+			Where(
+				"id > (SELECT COALESCE(MAX(r.id), 0) FROM ledger_entries r WHERE r.assessment_id = ? AND r.type_id = ?)",
+				assessmentID, ledgerEntryType.Reversal,
+			)
+	}
+}
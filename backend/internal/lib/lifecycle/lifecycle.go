@@ -0,0 +1,74 @@
+// Package lifecycle moves batches between statuses.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"markup/internal/domain/enums/batchStatus"
+	"markup/internal/domain/models"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrStatusChanged is returned if status of batch was changed concurrently.
+	ErrStatusChanged = errors.New("batch status was changed")
+)
+
+// transitions lists statuses that batch can be moved to from each status.
+var transitions = map[uint][]uint{
+	batchStatus.Draft:     {batchStatus.Scheduled, batchStatus.Active, batchStatus.Archived},
+	batchStatus.Scheduled: {batchStatus.Draft, batchStatus.Active, batchStatus.Archived},
+	batchStatus.Active:    {batchStatus.Paused, batchStatus.Completed},
+	batchStatus.Paused:    {batchStatus.Active, batchStatus.Completed, batchStatus.Archived},
+	batchStatus.Completed: {batchStatus.Active, batchStatus.Archived},
+	batchStatus.Archived:  {},
+}
+
+// CanTransition reports whether batch can be moved from one status to another.
+func CanTransition(from uint, to uint) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Transition moves batch to status and records models.BatchTransition made by actorID, nil for schedule
+// and other automatic transitions.
+// batch is updated in place.
+func Transition(tx *gorm.DB, batch *models.Batch, to uint, actorID *uint) error {
+	const op = "lifecycle.Transition"
+
+	if !CanTransition(batch.StatusID, to) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidTransition)
+	}
+
+	now := time.Now()
+	// Condition on status guarantees that concurrent transitions from the same status do not both succeed.
+	result := tx.Model(&models.Batch{}).
+		Where("id = ? AND status_id = ?", batch.ID, batch.StatusID).
+		Updates(map[string]any{
+			"status_id":         to,
+			"status_changed_at": now,
+		})
+	if err := result.Error; err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrStatusChanged)
+	}
+
+	transition := models.BatchTransition{
+		BatchID:      batch.ID,
+		FromStatusID: batch.StatusID,
+		ToStatusID:   to,
+		ActorID:      actorID,
+		CreatedAt:    now,
+	}
+	if err := tx.Create(&transition).Error; err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	batch.StatusID = to
+	batch.StatusChangedAt = &now
+	return nil
+}
@@ -0,0 +1,135 @@
+// Package loginlimit throttles failed sign in attempts per client IP and per account.
+// After Rule.Threshold failures the key is locked, and every next failure doubles lockout up to Rule.MaxLockout.
+package loginlimit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Entry is a state of throttled key.
+type Entry struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store keeps throttling state. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns entry of key or zero Entry if key is unknown.
+	Get(ctx context.Context, key string) (Entry, error)
+	// Fail registers failed attempt and returns updated entry.
+	// Failures counter starts over if the last failure happened more than window ago.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error)
+	// Lock forbids attempts for key until given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets failures of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Rule describes when and for how long key is locked.
+type Rule struct {
+	// Threshold is a number of failures that locks the key.
+	Threshold int
+	// BaseLockout is a duration of the first lockout.
+	BaseLockout time.Duration
+	// MaxLockout caps lockout duration.
+	MaxLockout time.Duration
+	// Window is a time after the last failure when failures are forgotten.
+	Window time.Duration
+}
+
+// lockout returns duration of lockout after given number of failures.
+func (r Rule) lockout(failures int) time.Duration {
+	if failures < r.Threshold {
+		return 0
+	}
+
+	d := r.BaseLockout
+	for i := r.Threshold; i < failures && d < r.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, r.MaxLockout)
+}
+
+type Limiter struct {
+	store   Store
+	ip      Rule
+	account Rule
+}
+
+func New(store Store, ip Rule, account Rule) *Limiter {
+	return &Limiter{
+		store:   store,
+		ip:      ip,
+		account: account,
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// Check returns time left until sign in attempts from ip or to account are allowed again.
+// Zero means that attempt is allowed.
+func (l *Limiter) Check(ctx context.Context, ip string, account string) (time.Duration, error) {
+	const op = "loginlimit.Check"
+
+	var wait time.Duration
+	for _, key := range []string{ipKey(ip), accountKey(account)} {
+		entry, err := l.store.Get(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, time.Until(entry.LockedUntil))
+	}
+
+	return max(wait, 0), nil
+}
+
+// Fail registers failed attempt and locks ip or account if they exceed their rules.
+// Returns time left until attempts are allowed again.
+func (l *Limiter) Fail(ctx context.Context, ip string, account string) (time.Duration, error) {
+	const op = "loginlimit.Fail"
+
+	now := time.Now()
+	var wait time.Duration
+	for key, rule := range map[string]Rule{ipKey(ip): l.ip, accountKey(account): l.account} {
+		entry, err := l.store.Fail(ctx, key, now, rule.Window)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		lockout := rule.lockout(entry.Failures)
+		if lockout == 0 {
+			continue
+		}
+		if err := l.store.Lock(ctx, key, now.Add(lockout)); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, lockout)
+	}
+
+	return wait, nil
+}
+
+// Succeed forgets failures of account after successful sign in.
+func (l *Limiter) Succeed(ctx context.Context, account string) error {
+	return l.Unlock(ctx, account)
+}
+
+// Unlock forgets failures of account and lifts its lockout.
+func (l *Limiter) Unlock(ctx context.Context, account string) error {
+	const op = "loginlimit.Unlock"
+
+	if err := l.store.Reset(ctx, accountKey(account)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package loginlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps throttling state in process memory. It suits single instance deployments.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, window)
+
+	entry := s.entries[key]
+	if now.Sub(entry.LastFailureAt) > window {
+		entry.Failures = 0
+	}
+	entry.Failures++
+	entry.LastFailureAt = now
+	s.entries[key] = entry
+
+	return entry, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[key]
+	entry.LockedUntil = until
+	s.entries[key] = entry
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// sweep removes entries that are neither locked nor counted anymore. It runs at most once per window.
+// Must be called with mu held.
+func (s *MemoryStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if now.After(entry.LockedUntil) && now.Sub(entry.LastFailureAt) > window {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package loginlimit
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"markup/internal/domain/models"
+	"time"
+)
+
+// PostgresStore keeps throttling state in models.LoginThrottle table, so that it is shared by all instances.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{
+		db: db,
+	}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	var throttle models.LoginThrottle
+	err := s.db.WithContext(ctx).Where("key = ?", key).First(&throttle).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Entry{}, nil
+		}
+		return Entry{}, err
+	}
+
+	return toEntry(throttle), nil
+}
+
+func (s *PostgresStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	var throttle models.LoginThrottle
+	// Upsert makes concurrent failures of the same key increment counter atomically.
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, now.Add(-window),
+	).Scan(&throttle).Error
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return toEntry(throttle), nil
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.WithContext(ctx).
+		Model(&models.LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+func toEntry(throttle models.LoginThrottle) Entry {
+	entry := Entry{
+		Failures:      throttle.Failures,
+		LastFailureAt: throttle.LastFailureAt,
+	}
+	if throttle.LockedUntil != nil {
+		entry.LockedUntil = *throttle.LockedUntil
+	}
+	return entry
+}
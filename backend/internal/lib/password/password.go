@@ -0,0 +1,66 @@
+// Package password checks passwords against strength policy.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is a maximal length of password in bytes. Longer passwords are rejected by bcrypt.
+const MaxLength = 72
+
+var ErrWeak = errors.New("password is too weak")
+
+// Policy describes password strength rules.
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Validate returns ErrWeak that lists every rule password breaks, or nil if password satisfies policy.
+func (p Policy) Validate(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var violations []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("be at least %d characters long", p.MinLength))
+	}
+	if len(password) > MaxLength {
+		violations = append(violations, fmt.Sprintf("be at most %d bytes long", MaxLength))
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "contain a symbol")
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: password must %s", ErrWeak, strings.Join(violations, ", "))
+	}
+	return nil
+}
@@ -45,3 +45,16 @@ func UnauthorizedError(c *gin.Context) {
 		"error": "unauthorized",
 	})
 }
+
+func ValidationError(c *gin.Context, fields any) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "validation failed",
+		"fields": fields,
+	})
+}
+
+func QuotaExhaustedError(c *gin.Context) {
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": "quota exhausted",
+	})
+}
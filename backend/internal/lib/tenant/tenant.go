@@ -0,0 +1,32 @@
+// Package tenant provides access to organization that current request is scoped to.
+package tenant
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey is a gin context key under which organization id is stored.
+const contextKey = "organization_id"
+
+// Set stores organization id that request is scoped to. nil means that request is not scoped.
+func Set(c *gin.Context, organizationID *uint) {
+	c.Set(contextKey, organizationID)
+}
+
+// ID returns organization id that request is scoped to or nil if request may access all organizations.
+// If scope was not set, request is scoped to non-existent organization, so that nothing is accessible.
+func ID(c *gin.Context) *uint {
+	none := uint(0)
+
+	value, exists := c.Get(contextKey)
+	if !exists {
+		return &none
+	}
+
+	organizationID, ok := value.(*uint)
+	if !ok {
+		return &none
+	}
+
+	return organizationID
+}
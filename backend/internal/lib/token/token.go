@@ -0,0 +1,29 @@
+// Package token generates random opaque tokens and hashes them for storage.
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// size is a number of random bytes in generated token.
+const size = 32
+
+// Generate returns new random token encoded as hex string.
+func Generate() (string, error) {
+	const op = "token.Generate"
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Hash returns sha256 hash of token encoded as hex string. Only hashes of tokens are stored in database.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
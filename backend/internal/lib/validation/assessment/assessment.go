@@ -0,0 +1,402 @@
+// Package assessment provides validation of submitted assessment fields against models.MarkupType schema.
+package assessment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/models"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why submitted field or group of fields is invalid.
+type FieldError struct {
+	MarkupTypeFieldID uint   `json:"markup_type_field_id,omitempty"`
+	GroupID           uint   `json:"group_id,omitempty"`
+	Error             string `json:"error"`
+}
+
+// Errors is a list of per-field validation errors.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fmt.Sprintf("field %d (group %d): %s", fieldErr.MarkupTypeFieldID, fieldErr.GroupID, fieldErr.Error)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks that every field belongs to markupType, that radio and select groups have exactly one selection,
+// that required groups are answered, that text fields meet length and pattern limits and that value fields
+// (rating, numeric, range, span, bounding box) carry valid values. data is models.Markup.Data that spans refer to.
+// Returns Errors if submission is invalid.
+func Validate(markupType models.MarkupType, data string, fields []models.AssessmentField) error {
+	var errs Errors
+	var columns map[string]string
+
+	schema := make(map[uint]models.MarkupTypeField, len(markupType.Fields))
+	groups := make(map[uint][]models.MarkupTypeField)
+	groupIDs := make([]uint, 0)
+	for _, field := range markupType.Fields {
+		schema[field.ID] = field
+		if _, ok := groups[field.GroupID]; !ok {
+			groupIDs = append(groupIDs, field.GroupID)
+		}
+		groups[field.GroupID] = append(groups[field.GroupID], field)
+	}
+	slices.Sort(groupIDs)
+
+	// number of answered fields in every group
+	answered := make(map[uint]int)
+	seen := make(map[uint]bool, len(fields))
+
+	for _, field := range fields {
+		mtf, ok := schema[field.MarkupTypeFieldID]
+		if !ok {
+			errs = append(errs, FieldError{
+				MarkupTypeFieldID: field.MarkupTypeFieldID,
+				Error:             "field does not belong to markup type",
+			})
+			continue
+		}
+		if seen[field.MarkupTypeFieldID] {
+			errs = append(errs, FieldError{
+				MarkupTypeFieldID: mtf.ID,
+				GroupID:           mtf.GroupID,
+				Error:             "field is submitted more than once",
+			})
+			continue
+		}
+		seen[field.MarkupTypeFieldID] = true
+
+		if mtf.AssessmentTypeID == assessmentType.Span && columns == nil {
+			var err error
+			if columns, err = parseData(data); err != nil {
+				errs = append(errs, FieldError{
+					MarkupTypeFieldID: mtf.ID,
+					GroupID:           mtf.GroupID,
+					Error:             "markup data is not a JSON object of strings",
+				})
+				continue
+			}
+		}
+
+		var msg string
+		switch {
+		case mtf.AssessmentTypeID != assessmentType.Text && field.Text != nil && *field.Text != "":
+			msg = "text is not allowed for this field"
+		case !IsValueType(mtf.AssessmentTypeID) && hasValue(field):
+			msg = "value is not allowed for this field"
+		case mtf.AssessmentTypeID == assessmentType.Text:
+			msg = validateText(mtf, field.Text)
+		case mtf.AssessmentTypeID == assessmentType.Rating:
+			msg = validateRating(mtf, field)
+		case mtf.AssessmentTypeID == assessmentType.Numeric:
+			msg = validateNumeric(mtf, field)
+		case mtf.AssessmentTypeID == assessmentType.Range:
+			msg = validateRange(mtf, field)
+		case mtf.AssessmentTypeID == assessmentType.Span:
+			msg = validateSpans(field, columns)
+		case mtf.AssessmentTypeID == assessmentType.BoundingBox:
+			msg = validateBoxes(field)
+		}
+		if msg != "" {
+			errs = append(errs, FieldError{
+				MarkupTypeFieldID: mtf.ID,
+				GroupID:           mtf.GroupID,
+				Error:             msg,
+			})
+			continue
+		}
+
+		answered[mtf.GroupID]++
+	}
+
+	for _, groupID := range groupIDs {
+		groupFields := groups[groupID]
+		count := answered[groupID]
+
+		switch groupFields[0].AssessmentTypeID {
+		case assessmentType.Radio, assessmentType.Select:
+			if count != 1 {
+				errs = append(errs, FieldError{
+					GroupID: groupID,
+					Error:   fmt.Sprintf("exactly one option must be selected, got %d", count),
+				})
+			}
+		default:
+			if count == 0 && isRequired(groupFields) {
+				errs = append(errs, FieldError{
+					GroupID: groupID,
+					Error:   "group is required",
+				})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidatePattern checks that models.MarkupTypeField.Pattern is a valid regular expression.
+func ValidatePattern(pattern *string) error {
+	if pattern == nil {
+		return nil
+	}
+	if _, err := regexp.Compile(*pattern); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", *pattern, err)
+	}
+	return nil
+}
+
+var keyRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidateSchema checks every field with ValidateField and checks that fields are consistent with each other:
+// every group has its own key, option keys and hotkeys are unique and radio and select groups have at most
+// one option selected by default.
+func ValidateSchema(fields []models.MarkupTypeField) error {
+	groupKeys := make(map[uint]string)
+	groupIDs := make(map[string]uint)
+	keys := make(map[string]bool)
+	hotkeys := make(map[string]bool)
+	defaults := make(map[uint]int)
+
+	for _, field := range fields {
+		if err := ValidateField(field); err != nil {
+			return fmt.Errorf("field %s: %w", field.FullKey(), err)
+		}
+
+		if groupKey, ok := groupKeys[field.GroupID]; ok && groupKey != field.GroupKey {
+			return fmt.Errorf("group %d has different keys: %s and %s", field.GroupID, groupKey, field.GroupKey)
+		}
+		if groupID, ok := groupIDs[field.GroupKey]; ok && groupID != field.GroupID {
+			return fmt.Errorf("group key %s is used by groups %d and %d", field.GroupKey, groupID, field.GroupID)
+		}
+		groupKeys[field.GroupID] = field.GroupKey
+		groupIDs[field.GroupKey] = field.GroupID
+
+		if keys[field.FullKey()] {
+			return fmt.Errorf("key %s is not unique", field.FullKey())
+		}
+		keys[field.FullKey()] = true
+
+		if field.Hotkey != nil {
+			if hotkeys[*field.Hotkey] {
+				return fmt.Errorf("hotkey %s is not unique", *field.Hotkey)
+			}
+			hotkeys[*field.Hotkey] = true
+		}
+
+		if field.IsDefault {
+			defaults[field.GroupID]++
+			isSingle := field.AssessmentTypeID == assessmentType.Radio || field.AssessmentTypeID == assessmentType.Select
+			if isSingle && defaults[field.GroupID] > 1 {
+				return fmt.Errorf("group %s has more than one default option", field.GroupKey)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateField checks that keys and metadata of models.MarkupTypeField are well-formed
+// and that value limits are consistent.
+func ValidateField(field models.MarkupTypeField) error {
+	if !keyRegexp.MatchString(field.GroupKey) {
+		return fmt.Errorf("group_key %q must consist of lowercase letters, digits, '_' and '-'", field.GroupKey)
+	}
+	if !keyRegexp.MatchString(field.Key) {
+		return fmt.Errorf("key %q must consist of lowercase letters, digits, '_' and '-'", field.Key)
+	}
+	if field.Color != nil && !colorRegexp.MatchString(*field.Color) {
+		return fmt.Errorf("color %q must be in #rrggbb format", *field.Color)
+	}
+	if field.Hotkey != nil && utf8.RuneCountInString(*field.Hotkey) != 1 {
+		return fmt.Errorf("hotkey %q must be a single character", *field.Hotkey)
+	}
+	if field.MinLength != nil && field.MaxLength != nil && *field.MinLength > *field.MaxLength {
+		return errors.New("min_length must not be greater than max_length")
+	}
+	if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+		return errors.New("min must not be greater than max")
+	}
+	if field.Step != nil && *field.Step <= 0 {
+		return errors.New("step must be positive")
+	}
+	return ValidatePattern(field.Pattern)
+}
+
+// IsValueType reports whether fields of assessment type carry value instead of being just selected.
+func IsValueType(assessmentTypeID uint) bool {
+	switch assessmentTypeID {
+	case assessmentType.Rating, assessmentType.Numeric, assessmentType.Range,
+		assessmentType.Span, assessmentType.BoundingBox:
+		return true
+	}
+	return false
+}
+
+// validateText returns error message if text does not satisfy field limits or empty string otherwise.
+func validateText(field models.MarkupTypeField, text *string) string {
+	if text == nil || strings.TrimSpace(*text) == "" {
+		return "text must not be empty"
+	}
+
+	length := utf8.RuneCountInString(*text)
+	if field.MinLength != nil && length < *field.MinLength {
+		return fmt.Sprintf("text must be at least %d characters long", *field.MinLength)
+	}
+	if field.MaxLength != nil && length > *field.MaxLength {
+		return fmt.Sprintf("text must be at most %d characters long", *field.MaxLength)
+	}
+	if field.Pattern != nil && *field.Pattern != "" {
+		re, err := regexp.Compile(*field.Pattern)
+		if err != nil {
+			return "field pattern is invalid"
+		}
+		if !re.MatchString(*text) {
+			return fmt.Sprintf("text must match pattern %s", *field.Pattern)
+		}
+	}
+
+	return ""
+}
+
+// validateRating returns error message if rating is not an integer in [Min, Max]. Default scale is 1-5.
+func validateRating(field models.MarkupTypeField, value models.AssessmentField) string {
+	if value.Number == nil || value.NumberTo != nil {
+		return "rating requires number"
+	}
+
+	minValue, maxValue := 1.0, 5.0
+	if field.Min != nil {
+		minValue = *field.Min
+	}
+	if field.Max != nil {
+		maxValue = *field.Max
+	}
+
+	if *value.Number != math.Trunc(*value.Number) {
+		return "rating must be an integer"
+	}
+	if *value.Number < minValue || *value.Number > maxValue {
+		return fmt.Sprintf("rating must be between %g and %g", minValue, maxValue)
+	}
+	return ""
+}
+
+// validateNumeric returns error message if number is out of field bounds or does not match its step.
+func validateNumeric(field models.MarkupTypeField, value models.AssessmentField) string {
+	if value.Number == nil || value.NumberTo != nil {
+		return "numeric field requires number"
+	}
+	return validateNumber(field, *value.Number)
+}
+
+// validateRange returns error message if range bounds are missing, reversed or out of field bounds.
+func validateRange(field models.MarkupTypeField, value models.AssessmentField) string {
+	if value.Number == nil || value.NumberTo == nil {
+		return "range requires number and number_to"
+	}
+	if *value.Number > *value.NumberTo {
+		return "number must not be greater than number_to"
+	}
+	if msg := validateNumber(field, *value.Number); msg != "" {
+		return msg
+	}
+	return validateNumber(field, *value.NumberTo)
+}
+
+func validateNumber(field models.MarkupTypeField, n float64) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return "number must be finite"
+	}
+	if field.Min != nil && n < *field.Min {
+		return fmt.Sprintf("number must be at least %g", *field.Min)
+	}
+	if field.Max != nil && n > *field.Max {
+		return fmt.Sprintf("number must be at most %g", *field.Max)
+	}
+	if field.Step != nil && *field.Step > 0 {
+		var base float64
+		if field.Min != nil {
+			base = *field.Min
+		}
+		steps := (n - base) / *field.Step
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return fmt.Sprintf("number must be a multiple of %g", *field.Step)
+		}
+	}
+	return ""
+}
+
+// validateSpans returns error message if any span is empty or does not fit into respective data column.
+// Offsets are measured in characters (runes), end is exclusive.
+func validateSpans(value models.AssessmentField, columns map[string]string) string {
+	if len(value.Spans) == 0 {
+		return "at least one span is required"
+	}
+	for _, span := range value.Spans {
+		text, ok := columns[span.Column]
+		if !ok {
+			return fmt.Sprintf("markup data has no column %q", span.Column)
+		}
+		if span.Start < 0 || span.End <= span.Start {
+			return fmt.Sprintf("span %s is empty or reversed", span)
+		}
+		if span.End > utf8.RuneCountInString(text) {
+			return fmt.Sprintf("span %s is out of text bounds", span)
+		}
+	}
+	return ""
+}
+
+// validateBoxes returns error message if any box is degenerate or lies outside of normalized image bounds.
+func validateBoxes(value models.AssessmentField) string {
+	if len(value.Boxes) == 0 {
+		return "at least one box is required"
+	}
+	for _, box := range value.Boxes {
+		if box.Width <= 0 || box.Height <= 0 {
+			return fmt.Sprintf("box %s must have positive size", box)
+		}
+		if box.X < 0 || box.Y < 0 || box.X+box.Width > 1 || box.Y+box.Height > 1 {
+			return fmt.Sprintf("box %s must lie within [0, 1]", box)
+		}
+	}
+	return ""
+}
+
+// hasValue reports whether any value attribute of field is set.
+func hasValue(field models.AssessmentField) bool {
+	return field.Number != nil || field.NumberTo != nil || len(field.Spans) > 0 || len(field.Boxes) > 0
+}
+
+// parseData decodes models.Markup.Data into column -> text map.
+// Returns error if data is not a JSON object of strings.
+func parseData(data string) (map[string]string, error) {
+	columns := make(map[string]string)
+	if err := json.Unmarshal([]byte(data), &columns); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// isRequired reports whether any field of the group is marked as required.
+func isRequired(fields []models.MarkupTypeField) bool {
+	for _, field := range fields {
+		if field.IsRequired {
+			return true
+		}
+	}
+	return false
+}
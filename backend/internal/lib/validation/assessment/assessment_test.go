@@ -0,0 +1,271 @@
+package assessment
+
+import (
+	"errors"
+	"markup/internal/domain/enums/assessmentType"
+	"markup/internal/domain/models"
+	"math"
+	"strings"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+const data = `{"text":"hello world"}`
+
+// schema has a field of every kind, text and checkbox groups are required.
+var schema = models.MarkupType{Fields: []models.MarkupTypeField{
+	{ID: 1, GroupID: 1, AssessmentTypeID: assessmentType.Radio},
+	{ID: 2, GroupID: 1, AssessmentTypeID: assessmentType.Radio},
+	{
+		ID: 3, GroupID: 2, AssessmentTypeID: assessmentType.Text, IsRequired: true,
+		MinLength: ptr(3), MaxLength: ptr(10), Pattern: ptr(`^[a-z ]+$`),
+	},
+	{ID: 4, GroupID: 3, AssessmentTypeID: assessmentType.Rating},
+	{ID: 5, GroupID: 4, AssessmentTypeID: assessmentType.Numeric, Min: ptr(0.0), Max: ptr(10.0), Step: ptr(0.5)},
+	{ID: 6, GroupID: 5, AssessmentTypeID: assessmentType.Range, Min: ptr(0.0), Max: ptr(10.0)},
+	{ID: 7, GroupID: 6, AssessmentTypeID: assessmentType.Span},
+	{ID: 8, GroupID: 7, AssessmentTypeID: assessmentType.BoundingBox},
+	{ID: 9, GroupID: 8, AssessmentTypeID: assessmentType.Checkbox, IsRequired: true},
+}}
+
+// submission returns valid answers to required groups of schema with extra fields appended.
+func submission(extra ...models.AssessmentField) []models.AssessmentField {
+	return append([]models.AssessmentField{
+		{MarkupTypeFieldID: 1},
+		{MarkupTypeFieldID: 3, Text: ptr("hello")},
+		{MarkupTypeFieldID: 9},
+	}, extra...)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		fields []models.AssessmentField
+		err    string
+	}{
+		{"valid", data, submission(), ""},
+		{
+			"valid values", data,
+			submission(
+				models.AssessmentField{MarkupTypeFieldID: 4, Number: ptr(3.0)},
+				models.AssessmentField{MarkupTypeFieldID: 5, Number: ptr(2.5)},
+				models.AssessmentField{MarkupTypeFieldID: 6, Number: ptr(1.0), NumberTo: ptr(2.0)},
+				models.AssessmentField{MarkupTypeFieldID: 7, Spans: []models.AssessmentSpan{{Column: "text", Start: 0, End: 5}}},
+				models.AssessmentField{MarkupTypeFieldID: 8, Boxes: []models.AssessmentBox{{X: 0.1, Y: 0.1, Width: 0.5, Height: 0.5}}},
+			),
+			"",
+		},
+		{
+			"radio group without selection", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 3, Text: ptr("hello")}, {MarkupTypeFieldID: 9}},
+			"exactly one option must be selected, got 0",
+		},
+		{
+			"radio group with two selections", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 2}),
+			"exactly one option must be selected, got 2",
+		},
+		{
+			"missing required group", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("hello")}},
+			"group is required",
+		},
+		{"unknown field", data, submission(models.AssessmentField{MarkupTypeFieldID: 100}), "does not belong"},
+		{"duplicate field", data, submission(models.AssessmentField{MarkupTypeFieldID: 9}), "more than once"},
+		{
+			"text of option", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1, Text: ptr("yes")}, {MarkupTypeFieldID: 3, Text: ptr("hello")}, {MarkupTypeFieldID: 9}},
+			"text is not allowed",
+		},
+		{
+			"value of option", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("hello")}, {MarkupTypeFieldID: 9, Number: ptr(1.0)}},
+			"value is not allowed",
+		},
+		{
+			"empty text", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("  ")}, {MarkupTypeFieldID: 9}},
+			"must not be empty",
+		},
+		{
+			"too short text", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("hi")}, {MarkupTypeFieldID: 9}},
+			"at least 3 characters",
+		},
+		{
+			"too long text", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("hello world!")}, {MarkupTypeFieldID: 9}},
+			"at most 10 characters",
+		},
+		{
+			"text does not match pattern", data,
+			[]models.AssessmentField{{MarkupTypeFieldID: 1}, {MarkupTypeFieldID: 3, Text: ptr("Hello")}, {MarkupTypeFieldID: 9}},
+			"must match pattern",
+		},
+		{"rating below scale", data, submission(models.AssessmentField{MarkupTypeFieldID: 4, Number: ptr(0.0)}), "between 1 and 5"},
+		{"rating above scale", data, submission(models.AssessmentField{MarkupTypeFieldID: 4, Number: ptr(6.0)}), "between 1 and 5"},
+		{"fractional rating", data, submission(models.AssessmentField{MarkupTypeFieldID: 4, Number: ptr(2.5)}), "integer"},
+		{"rating without number", data, submission(models.AssessmentField{MarkupTypeFieldID: 4}), "requires number"},
+		{"numeric below min", data, submission(models.AssessmentField{MarkupTypeFieldID: 5, Number: ptr(-1.0)}), "at least 0"},
+		{"numeric above max", data, submission(models.AssessmentField{MarkupTypeFieldID: 5, Number: ptr(10.5)}), "at most 10"},
+		{"numeric off step", data, submission(models.AssessmentField{MarkupTypeFieldID: 5, Number: ptr(1.2)}), "multiple of 0.5"},
+		{"infinite numeric", data, submission(models.AssessmentField{MarkupTypeFieldID: 5, Number: ptr(math.Inf(1))}), "finite"},
+		{
+			"reversed range", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 6, Number: ptr(3.0), NumberTo: ptr(2.0)}),
+			"not be greater than number_to",
+		},
+		{
+			"range out of bounds", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 6, Number: ptr(3.0), NumberTo: ptr(20.0)}),
+			"at most 10",
+		},
+		{"range without end", data, submission(models.AssessmentField{MarkupTypeFieldID: 6, Number: ptr(3.0)}), "requires number and number_to"},
+		{"span without spans", data, submission(models.AssessmentField{MarkupTypeFieldID: 7}), "at least one span"},
+		{
+			"span of unknown column", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 7, Spans: []models.AssessmentSpan{{Column: "title", Start: 0, End: 1}}}),
+			`no column "title"`,
+		},
+		{
+			"reversed span", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 7, Spans: []models.AssessmentSpan{{Column: "text", Start: 3, End: 3}}}),
+			"empty or reversed",
+		},
+		{
+			"span out of text", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 7, Spans: []models.AssessmentSpan{{Column: "text", Start: 5, End: 12}}}),
+			"out of text bounds",
+		},
+		{
+			"span of malformed data", `["hello"]`,
+			submission(models.AssessmentField{MarkupTypeFieldID: 7, Spans: []models.AssessmentSpan{{Column: "text", Start: 0, End: 1}}}),
+			"not a JSON object of strings",
+		},
+		{"box without boxes", data, submission(models.AssessmentField{MarkupTypeFieldID: 8}), "at least one box"},
+		{
+			"box of zero size", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 8, Boxes: []models.AssessmentBox{{X: 0.1, Y: 0.1, Width: 0, Height: 0.5}}}),
+			"positive size",
+		},
+		{
+			"box out of image", data,
+			submission(models.AssessmentField{MarkupTypeFieldID: 8, Boxes: []models.AssessmentBox{{X: 0.6, Y: 0.1, Width: 0.5, Height: 0.5}}}),
+			"within [0, 1]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(schema, tt.data, tt.fields)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected Errors, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	option := func(groupID uint, groupKey string, key string) models.MarkupTypeField {
+		return models.MarkupTypeField{GroupID: groupID, GroupKey: groupKey, Key: key, AssessmentTypeID: assessmentType.Radio}
+	}
+	withDefault := func(field models.MarkupTypeField) models.MarkupTypeField {
+		field.IsDefault = true
+		return field
+	}
+	withHotkey := func(field models.MarkupTypeField, hotkey string) models.MarkupTypeField {
+		field.Hotkey = &hotkey
+		return field
+	}
+
+	tests := []struct {
+		name   string
+		fields []models.MarkupTypeField
+		err    string
+	}{
+		{"valid", []models.MarkupTypeField{option(1, "answer", "yes"), option(1, "answer", "no"), option(2, "sure", "yes")}, ""},
+		{"duplicate key", []models.MarkupTypeField{option(1, "answer", "yes"), option(1, "answer", "yes")}, "is not unique"},
+		{"group with different keys", []models.MarkupTypeField{option(1, "answer", "yes"), option(1, "other", "no")}, "different keys"},
+		{"group key of two groups", []models.MarkupTypeField{option(1, "answer", "yes"), option(2, "answer", "no")}, "used by groups"},
+		{
+			"duplicate hotkey",
+			[]models.MarkupTypeField{withHotkey(option(1, "answer", "yes"), "y"), withHotkey(option(1, "answer", "no"), "y")},
+			"hotkey y is not unique",
+		},
+		{
+			"two defaults of radio group",
+			[]models.MarkupTypeField{withDefault(option(1, "answer", "yes")), withDefault(option(1, "answer", "no"))},
+			"more than one default",
+		},
+		{"invalid field", []models.MarkupTypeField{option(1, "answer", "Yes")}, "field answer.Yes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(tt.fields)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateField(t *testing.T) {
+	field := func(modify func(field *models.MarkupTypeField)) models.MarkupTypeField {
+		field := models.MarkupTypeField{GroupKey: "answer", Key: "yes", AssessmentTypeID: assessmentType.Radio}
+		modify(&field)
+		return field
+	}
+
+	tests := []struct {
+		name  string
+		field models.MarkupTypeField
+		err   string
+	}{
+		{"valid", field(func(f *models.MarkupTypeField) { f.Color = ptr("#00ff00"); f.Hotkey = ptr("y") }), ""},
+		{"empty key", field(func(f *models.MarkupTypeField) { f.Key = "" }), "key"},
+		{"uppercase key", field(func(f *models.MarkupTypeField) { f.Key = "Yes" }), "key \"Yes\""},
+		{"key with space", field(func(f *models.MarkupTypeField) { f.Key = "yes sure" }), "key \"yes sure\""},
+		{"key starting with separator", field(func(f *models.MarkupTypeField) { f.Key = "_yes" }), "key \"_yes\""},
+		{"invalid group key", field(func(f *models.MarkupTypeField) { f.GroupKey = "answer.1" }), "group_key"},
+		{"invalid color", field(func(f *models.MarkupTypeField) { f.Color = ptr("green") }), "#rrggbb"},
+		{"long hotkey", field(func(f *models.MarkupTypeField) { f.Hotkey = ptr("yes") }), "single character"},
+		{"reversed length", field(func(f *models.MarkupTypeField) { f.MinLength = ptr(5); f.MaxLength = ptr(3) }), "min_length"},
+		{"reversed bounds", field(func(f *models.MarkupTypeField) { f.Min = ptr(5.0); f.Max = ptr(3.0) }), "min must not"},
+		{"zero step", field(func(f *models.MarkupTypeField) { f.Step = ptr(0.0) }), "step must be positive"},
+		{"invalid pattern", field(func(f *models.MarkupTypeField) { f.Pattern = ptr("[a-z") }), "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateField(tt.field)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
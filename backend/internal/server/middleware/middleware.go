@@ -3,14 +3,31 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"markup/internal/domain/enums/permissions"
 	"markup/internal/domain/models"
+	"markup/internal/lib/auth"
 	"markup/internal/lib/jwt"
+	"markup/internal/lib/responses"
+	"markup/internal/lib/tenant"
+	"markup/internal/lib/token"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func AuthMiddleware(db *gorm.DB, jwtSecret string) gin.HandlerFunc {
+// apiKeyUsageInterval limits how often models.APIKey LastUsedAt is updated.
+const apiKeyUsageInterval = time.Minute
+
+// AuthMiddleware authenticates user by access token in Authorization header or by models.APIKey in X-API-Key header.
+func AuthMiddleware(db *gorm.DB, keySet *jwt.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, db, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
@@ -19,7 +36,7 @@ func AuthMiddleware(db *gorm.DB, jwtSecret string) gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := jwt.ValidateToken(tokenString, jwtSecret)
+		claims, err := keySet.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
@@ -28,14 +45,156 @@ func AuthMiddleware(db *gorm.DB, jwtSecret string) gin.HandlerFunc {
 
 		// Fetch the user with roles from the database
 		var user models.User
-		if err := db.Preload("Roles").First(&user, claims.UserID).Error; err != nil {
+		if err := db.Preload("Roles.Permissions").Preload("Permissions").First(&user, claims.UserID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 			c.Abort()
 			return
 		}
+		if user.IsDisabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user is disabled"})
+			c.Abort()
+			return
+		}
+		if user.TokenVersion != claims.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token is revoked"})
+			c.Abort()
+			return
+		}
 
 		// Store the user in the Gin context
 		c.Set("user", user)
 		c.Next()
 	}
 }
+
+// authenticateAPIKey stores owner of API key in the Gin context. User is granted only permissions of the key
+// that are granted to user themselves.
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, key string) {
+	var apiKey models.APIKey
+	err := db.
+		Preload("Permissions").
+		Where("key_hash = ? AND revoked_at IS NULL", token.Hash(key)).
+		First(&apiKey).Error
+	if err != nil || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := db.Preload("Roles.Permissions").Preload("Permissions").First(&user, apiKey.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		c.Abort()
+		return
+	}
+	if user.IsDisabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user is disabled"})
+		c.Abort()
+		return
+	}
+
+	granted := make([]models.Permission, 0, len(apiKey.Permissions))
+	for _, permission := range apiKey.Permissions {
+		if user.Can(permission.Name) {
+			granted = append(granted, permission)
+		}
+	}
+	for i := range user.Roles {
+		user.Roles[i].Permissions = nil
+	}
+	user.Permissions = granted
+
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > apiKeyUsageInterval {
+		db.Model(&apiKey).UpdateColumn("last_used_at", time.Now())
+	}
+
+	c.Set("user", user)
+	c.Set("api_key", apiKey)
+	c.Next()
+}
+
+// PermissionMiddleware aborts request if authenticated user is not granted all of the permissions.
+// Must be used after AuthMiddleware.
+func PermissionMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := auth.User(c)
+		if err != nil {
+			responses.UnauthorizedError(c)
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !user.Can(permission) {
+				responses.ForbiddenError(c)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// AnyPermissionMiddleware aborts request if authenticated user is granted none of the permissions.
+// Must be used after AuthMiddleware.
+func AnyPermissionMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := auth.User(c)
+		if err != nil {
+			responses.UnauthorizedError(c)
+			c.Abort()
+			return
+		}
+
+		if !slices.ContainsFunc(permissions, user.Can) {
+			responses.ForbiddenError(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// TenantMiddleware scopes request to organization of authenticated user.
+// Users with permissions.TenantManage are not scoped unless they act on behalf of organization
+// specified in X-Organization-ID header. Must be used after AuthMiddleware.
+func TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := auth.User(c)
+		if err != nil {
+			responses.UnauthorizedError(c)
+			c.Abort()
+			return
+		}
+
+		if !user.Can(permissions.TenantManage) {
+			organizationID := user.OrganizationID
+			if organizationID == nil {
+				none := uint(0)
+				organizationID = &none
+			}
+			tenant.Set(c, organizationID)
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("X-Organization-ID")
+		if header == "" {
+			tenant.Set(c, nil)
+			c.Next()
+			return
+		}
+
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid X-Organization-ID header"})
+			c.Abort()
+			return
+		}
+		organizationID := uint(id)
+		tenant.Set(c, &organizationID)
+		c.Next()
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"markup/internal/controllers"
 	envpkg "markup/internal/domain/enums/env"
+	"markup/internal/domain/enums/permissions"
+	"markup/internal/lib/jwt"
 	"markup/internal/server/middleware"
 )
 
@@ -14,7 +16,7 @@ import (
 func NewRouter(
 	log *slog.Logger,
 	env string,
-	jwtSecret string,
+	keySet *jwt.KeySet,
 	db *gorm.DB,
 	helloCon *controllers.HelloController,
 	markupTypeCon *controllers.MarkupType,
@@ -24,6 +26,15 @@ func NewRouter(
 	authCon *controllers.Auth,
 	profileCon *controllers.Profile,
 	honeypotCon *controllers.Honeypot,
+	permissionCon *controllers.Permission,
+	organizationCon *controllers.Organization,
+	userCon *controllers.User,
+	inviteCon *controllers.Invite,
+	apiKeyCon *controllers.APIKey,
+	oidcCon *controllers.OIDC,
+	passwordCon *controllers.Password,
+	auditLogCon *controllers.AuditLog,
+	earningsCon *controllers.Earnings,
 ) *gin.Engine {
 	var mode string
 	switch env {
@@ -43,62 +54,141 @@ func NewRouter(
 	r.Use(gin.Recovery())
 
 	r.GET("hello", helloCon.Hello)
+	r.GET("/.well-known/jwks.json", authCon.JWKS)
 	api := r.Group("/api")
 	{
 		v1protected := api.Group("/v1")
-		v1protected.Use(middleware.AuthMiddleware(db, jwtSecret))
+		v1protected.Use(middleware.AuthMiddleware(db, keySet), middleware.TenantMiddleware())
 		{
+			can := middleware.PermissionMiddleware
+			canAny := middleware.AnyPermissionMiddleware
+
 			markupTypes := v1protected.Group("/markupTypes")
 			{
-				markupTypes.GET("", markupTypeCon.Index)
-				markupTypes.GET("/:id", markupTypeCon.Find)
-				markupTypes.POST("", markupTypeCon.Store)
-				markupTypes.PUT("/:id", markupTypeCon.Update)
-				markupTypes.DELETE("/:id", markupTypeCon.Destroy)
+				markupTypes.GET("", can(permissions.MarkupTypeRead), markupTypeCon.Index)
+				markupTypes.GET("/:id", can(permissions.MarkupTypeRead), markupTypeCon.Find)
+				markupTypes.POST("", can(permissions.MarkupTypeCreate), markupTypeCon.Store)
+				markupTypes.GET("/:id/template", can(permissions.MarkupTypeRead), markupTypeCon.Export)
+				markupTypes.POST("/import", can(permissions.MarkupTypeCreate), markupTypeCon.Import)
+				markupTypes.PUT("/:id", can(permissions.MarkupTypeUpdate), markupTypeCon.Update)
+				markupTypes.DELETE("/:id", can(permissions.MarkupTypeDelete), markupTypeCon.Destroy)
 			}
 			batches := v1protected.Group("/batches")
 			{
-				batches.GET("", batchCon.Index)
-				batches.GET("/:id", batchCon.Find)
-				batches.POST("", batchCon.Store)
-				batches.PUT("/:id", batchCon.Update)
-				batches.DELETE("/:id", batchCon.Destroy)
+				batches.GET("", can(permissions.BatchRead), batchCon.Index)
+				batches.GET("/:id", can(permissions.BatchRead), batchCon.Find)
+				batches.POST("", can(permissions.BatchCreate), batchCon.Store)
+				batches.PUT("/:id", can(permissions.BatchUpdate), batchCon.Update)
+				batches.DELETE("/:id", can(permissions.BatchDelete), batchCon.Destroy)
 
-				batches.POST("/:id/markupTypes", batchCon.TieMarkupType)
-				batches.PUT("/:id/toggleActive", batchCon.ToggleIsActive)
+				batches.POST("/:id/markupTypes", can(permissions.BatchUpdate), batchCon.TieMarkupType)
+				batches.GET("/:id/markupTypes", can(permissions.BatchRead), batchCon.MarkupTypeHistory)
+				batches.GET("/:id/markupTypes/diff", can(permissions.BatchRead), batchCon.MarkupTypeDiff)
+				batches.POST("/:id/clone", can(permissions.BatchCreate), batchCon.Clone)
+				batches.PUT("/:id/status", can(permissions.BatchUpdate), batchCon.SetStatus)
+				batches.GET("/:id/transitions", can(permissions.BatchRead), batchCon.Transitions)
 
-				batches.GET("/:id/export", batchCon.Export)
+				batches.GET("/:id/export", can(permissions.BatchExport), batchCon.Export)
 			}
 			markups := v1protected.Group("/markups")
 			{
-				markups.GET("", markupCon.Index)
-				markups.GET("/:id", markupCon.Find)
+				markups.GET("", can(permissions.MarkupRead), markupCon.Index)
+				markups.GET("/:id", can(permissions.MarkupRead), markupCon.Find)
 			}
 			assessments := v1protected.Group("/assessments")
 			{
-				assessments.GET("", assessmentCon.Index)
-				assessments.GET("/:id", assessmentCon.Find)
-				assessments.POST("", assessmentCon.Store)
-				assessments.PUT("/:id", assessmentCon.Update)
-				assessments.DELETE("/:id", assessmentCon.Destroy)
+				assessments.GET("", can(permissions.AssessmentRead), assessmentCon.Index)
+				assessments.GET("/:id", can(permissions.AssessmentRead), assessmentCon.Find)
+				assessments.POST("", can(permissions.AssessmentCreate), assessmentCon.Store)
+				assessments.PUT("/:id", can(permissions.AssessmentAssess), assessmentCon.Update)
+				assessments.DELETE("/:id", can(permissions.AssessmentDelete), assessmentCon.Destroy)
+				assessments.GET("/:id/revisions", canAny(permissions.AssessmentRead, permissions.AssessmentAssess), assessmentCon.Revisions)
+				assessments.POST("/:id/revisions/:revision/restore", can(permissions.AssessmentAssess), assessmentCon.RestoreRevision)
 
-				assessments.POST("/next", assessmentCon.Next)
+				assessments.POST("/next", can(permissions.AssessmentAssess), assessmentCon.Next)
 			}
 			auth := v1protected.Group("/auth")
 			{
-				auth.POST("refresh", authCon.Refresh)
+				auth.POST("logout", authCon.Logout)
 				auth.GET("me", authCon.Me)
+				auth.PUT("password", passwordCon.Change)
 			}
 			profile := v1protected.Group("/profiles")
 			{
 				profile.GET("/me", profileCon.Me)
-				profile.GET("/:id", profileCon.Find)
-				profile.GET("", profileCon.Index)
+				profile.GET("/:id", can(permissions.UserRead), profileCon.Find)
+				profile.GET("", can(permissions.UserRead), profileCon.Index)
 			}
 			honeypots := v1protected.Group("/honeypots")
 			{
-				honeypots.GET("", honeypotCon.Index)
-				honeypots.POST("/:id", honeypotCon.Store)
+				honeypots.GET("", can(permissions.HoneypotRead), honeypotCon.Index)
+				honeypots.POST("/:id", can(permissions.HoneypotManage), honeypotCon.Store)
+			}
+			permissionsGroup := v1protected.Group("/permissions")
+			permissionsGroup.Use(can(permissions.PermissionManage))
+			{
+				permissionsGroup.GET("", permissionCon.Index)
+				permissionsGroup.GET("/roles", permissionCon.Roles)
+				permissionsGroup.POST("/roles/:id", permissionCon.GrantRole)
+				permissionsGroup.DELETE("/roles/:id/:permission", permissionCon.RevokeRole)
+				permissionsGroup.GET("/users/:id", permissionCon.User)
+				permissionsGroup.POST("/users/:id", permissionCon.GrantUser)
+				permissionsGroup.DELETE("/users/:id/:permission", permissionCon.RevokeUser)
+			}
+			users := v1protected.Group("/users")
+			users.Use(can(permissions.UserManage))
+			{
+				users.GET("", userCon.Index)
+				users.GET("/:id", userCon.Find)
+				users.POST("", userCon.Store)
+				users.PUT("/:id", userCon.Update)
+				users.DELETE("/:id", userCon.Destroy)
+				users.PUT("/:id/disable", userCon.Disable)
+				users.PUT("/:id/enable", userCon.Enable)
+				users.PUT("/:id/password", userCon.ResetPassword)
+				users.POST("/:id/logout", userCon.Logout)
+				users.POST("/:id/unlock", userCon.Unlock)
+				users.POST("/:id/roles", userCon.AssignRole)
+				users.DELETE("/:id/roles/:role", userCon.RevokeRole)
+				users.GET("/:id/invalidations", userCon.Invalidations)
+				users.POST("/:id/invalidations", userCon.InvalidateAssessments)
+			}
+			apiKeys := v1protected.Group("/apiKeys")
+			apiKeys.Use(can(permissions.APIKeyManage))
+			{
+				apiKeys.GET("", apiKeyCon.Index)
+				apiKeys.POST("", apiKeyCon.Store)
+				apiKeys.DELETE("/:id", apiKeyCon.Destroy)
+			}
+			invites := v1protected.Group("/invites")
+			invites.Use(can(permissions.InviteCreate))
+			{
+				invites.GET("", inviteCon.Index)
+				invites.POST("", inviteCon.Store)
+				invites.DELETE("/:id", inviteCon.Destroy)
+			}
+			auditLogs := v1protected.Group("/auditLogs")
+			auditLogs.Use(can(permissions.AuditRead))
+			{
+				auditLogs.GET("", auditLogCon.Index)
+			}
+			earnings := v1protected.Group("/earnings")
+			earnings.Use(can(permissions.EarningsRead))
+			{
+				earnings.GET("", earningsCon.Index)
+				earnings.GET("/balance", earningsCon.Balance)
+			}
+			payouts := v1protected.Group("/payouts")
+			payouts.Use(can(permissions.PayoutExport))
+			{
+				payouts.GET("/export", earningsCon.Export)
+			}
+			organizations := v1protected.Group("/organizations")
+			organizations.Use(can(permissions.TenantManage))
+			{
+				organizations.GET("", organizationCon.Index)
+				organizations.POST("", organizationCon.Store)
+				organizations.POST("/:id/users", organizationCon.AttachUser)
 			}
 		}
 
@@ -108,6 +198,11 @@ func NewRouter(
 			{
 				auth.POST("register", authCon.Register)
 				auth.POST("login", authCon.Login)
+				auth.POST("refresh", authCon.Refresh)
+				auth.GET("oidc/login", oidcCon.Login)
+				auth.GET("oidc/callback", oidcCon.Callback)
+				auth.POST("password/forgot", passwordCon.Forgot)
+				auth.POST("password/reset", passwordCon.Reset)
 			}
 		}
 	}
@@ -0,0 +1,7 @@
+INSERT INTO assessment_types (id, name) VALUES
+(6, 'rating'),
+(7, 'numeric'),
+(8, 'range'),
+(9, 'span'),
+(10, 'bounding_box')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,6 @@
+ALTER TABLE markup_type_examples DROP CONSTRAINT fk_markup_types_examples;
+
+ALTER TABLE markup_type_examples
+    ADD CONSTRAINT fk_markup_types_examples
+        FOREIGN KEY (markup_type_id) REFERENCES markup_types(id)
+            ON DELETE CASCADE;
@@ -0,0 +1,30 @@
+UPDATE markup_type_fields
+SET group_key = 'group_' || group_id
+WHERE group_key = '' OR group_key IS NULL;
+
+UPDATE markup_type_fields
+SET "key" = COALESCE(
+        NULLIF(TRIM(BOTH '_' FROM LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '_', 'g'))), ''),
+        'option_' || id
+    )
+WHERE "key" = '' OR "key" IS NULL;
+
+-- Make keys unique within group by adding field id to duplicates.
+UPDATE markup_type_fields mtf
+SET "key" = mtf."key" || '_' || mtf.id
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY markup_type_id, group_key, "key" ORDER BY id) AS rn
+    FROM markup_type_fields
+) duplicates
+WHERE duplicates.id = mtf.id AND duplicates.rn > 1;
+
+UPDATE markup_type_fields mtf
+SET position = ordered.rn
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY markup_type_id, group_id ORDER BY id) AS rn
+    FROM markup_type_fields
+) ordered
+WHERE ordered.id = mtf.id AND mtf.position = 0;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_markup_type_fields_key
+    ON markup_type_fields (markup_type_id, group_key, "key");
@@ -0,0 +1,41 @@
+INSERT INTO permissions (id, name) VALUES
+(1, 'batch:read'),
+(2, 'batch:create'),
+(3, 'batch:update'),
+(4, 'batch:delete'),
+(5, 'batch:export'),
+(6, 'markup_type:read'),
+(7, 'markup_type:create'),
+(8, 'markup_type:update'),
+(9, 'markup_type:delete'),
+(10, 'markup:read'),
+(11, 'assessment:create'),
+(12, 'assessment:assess'),
+(13, 'assessment:manage'),
+(14, 'assessment:read'),
+(15, 'honeypot:read'),
+(16, 'honeypot:manage'),
+(17, 'user:read'),
+(18, 'permission:manage')
+ON CONFLICT (id) DO NOTHING;
+
+-- admin
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions
+ON CONFLICT DO NOTHING;
+
+-- client
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 2, id FROM permissions WHERE name IN (
+    'batch:read', 'batch:create', 'batch:update', 'batch:export',
+    'markup_type:read', 'markup_type:create', 'markup_type:update', 'markup_type:delete',
+    'markup:read', 'assessment:read', 'honeypot:read'
+)
+ON CONFLICT DO NOTHING;
+
+-- assessor
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 3, id FROM permissions WHERE name IN (
+    'assessment:assess', 'markup_type:read'
+)
+ON CONFLICT DO NOTHING;
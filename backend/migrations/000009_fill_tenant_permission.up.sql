@@ -0,0 +1,7 @@
+INSERT INTO permissions (id, name) VALUES
+(19, 'tenant:manage')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(1, 19)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+INSERT INTO permissions (id, name) VALUES
+(21, 'invite:create')
+ON CONFLICT (id) DO NOTHING;
+
+-- admin and client
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(1, 21),
+(2, 21)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE password_resets
+    ADD CONSTRAINT fk_password_resets_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+            ON DELETE CASCADE;
@@ -0,0 +1,8 @@
+INSERT INTO permissions (id, name) VALUES
+(22, 'audit:read')
+ON CONFLICT (id) DO NOTHING;
+
+-- admin
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(1, 22)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE assessment_revisions
+    ADD CONSTRAINT fk_assessment_revisions_assessment
+        FOREIGN KEY (assessment_id) REFERENCES assessments(id)
+            ON DELETE CASCADE;
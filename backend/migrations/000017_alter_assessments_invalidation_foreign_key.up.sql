@@ -0,0 +1,4 @@
+ALTER TABLE assessments
+    ADD CONSTRAINT fk_assessments_invalidation
+        FOREIGN KEY (invalidation_id) REFERENCES assessment_invalidations(id)
+            ON DELETE SET NULL;
@@ -0,0 +1,8 @@
+UPDATE batches SET status_id = 3, status_changed_at = NOW() WHERE is_active IS TRUE;
+
+ALTER TABLE batches DROP COLUMN IF EXISTS is_active;
+
+ALTER TABLE batch_transitions
+    ADD CONSTRAINT fk_batch_transitions_batch
+        FOREIGN KEY (batch_id) REFERENCES batches(id)
+            ON DELETE CASCADE;
@@ -0,0 +1,15 @@
+INSERT INTO permissions (id, name) VALUES
+(23, 'earnings:read'),
+(24, 'payout:export')
+ON CONFLICT (id) DO NOTHING;
+
+-- admin
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(1, 23),
+(1, 24)
+ON CONFLICT DO NOTHING;
+
+-- assessor
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(3, 23)
+ON CONFLICT DO NOTHING;
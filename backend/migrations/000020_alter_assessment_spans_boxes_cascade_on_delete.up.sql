@@ -0,0 +1,13 @@
+ALTER TABLE assessment_spans DROP CONSTRAINT fk_assessment_fields_spans;
+
+ALTER TABLE assessment_spans
+    ADD CONSTRAINT fk_assessment_fields_spans
+        FOREIGN KEY (assessment_field_id) REFERENCES assessment_fields(id)
+            ON DELETE CASCADE;
+
+ALTER TABLE assessment_boxes DROP CONSTRAINT fk_assessment_fields_boxes;
+
+ALTER TABLE assessment_boxes
+    ADD CONSTRAINT fk_assessment_fields_boxes
+        FOREIGN KEY (assessment_field_id) REFERENCES assessment_fields(id)
+            ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+UPDATE assessments
+SET hash = regexp_replace(hash, '(\d+\.\d{2}),(\d+\.\d{2}),(\d+\.\d{2}),(\d+\.\d{2})', '\1%2C\2%2C\3%2C\4', 'g')
+WHERE hash ~ '\d+\.\d{2},\d+\.\d{2},\d+\.\d{2},\d+\.\d{2}';
+
+UPDATE markups
+SET correct_assessment_hash = regexp_replace(correct_assessment_hash, '(\d+\.\d{2}),(\d+\.\d{2}),(\d+\.\d{2}),(\d+\.\d{2})', '\1%2C\2%2C\3%2C\4', 'g')
+WHERE correct_assessment_hash ~ '\d+\.\d{2},\d+\.\d{2},\d+\.\d{2},\d+\.\d{2}';
@@ -0,0 +1,20 @@
+INSERT INTO permissions (id, name) VALUES
+(25, 'assessment:delete'),
+(26, 'api_key:manage')
+ON CONFLICT (id) DO NOTHING;
+
+-- admin
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(1, 25),
+(1, 26)
+ON CONFLICT DO NOTHING;
+
+-- client
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(2, 26)
+ON CONFLICT DO NOTHING;
+
+-- assessor
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+(3, 25)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,25 @@
+-- Batches created before organizations were introduced, or by users without organization, belong to organization
+-- of their members.
+UPDATE batches b
+SET organization_id = (
+    SELECT MIN(u.organization_id)
+    FROM user_batches ub
+    JOIN users u ON u.id = ub.user_id
+    WHERE ub.batch_id = b.id AND u.organization_id IS NOT NULL AND u.organization_id <> 0
+)
+WHERE b.organization_id IS NULL OR b.organization_id = 0;
+
+UPDATE markup_types mt
+SET organization_id = b.organization_id
+FROM batches b
+WHERE b.id = mt.batch_id AND (mt.organization_id IS NULL OR mt.organization_id = 0);
+
+UPDATE markup_types mt
+SET organization_id = u.organization_id
+FROM users u
+WHERE u.id = mt.user_id AND mt.batch_id IS NULL AND u.organization_id <> 0
+  AND (mt.organization_id IS NULL OR mt.organization_id = 0);
+
+-- Records that still have no organization are available only to users with tenant:manage permission.
+UPDATE batches SET organization_id = NULL WHERE organization_id = 0;
+UPDATE markup_types SET organization_id = NULL WHERE organization_id = 0;
@@ -0,0 +1,11 @@
+-- Assessment is settled again after reversal of its entries, so it may have several entries of the same type.
+DROP INDEX IF EXISTS idx_ledger_entries_assessment_type;
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_assessment_id ON ledger_entries (assessment_id);
+
+UPDATE assessments SET settled_at = (
+    SELECT MIN(le.created_at) FROM ledger_entries le WHERE le.assessment_id = assessments.id
+)
+WHERE settled_at IS NULL
+  AND EXISTS (SELECT 1 FROM ledger_entries le WHERE le.assessment_id = assessments.id)
+  AND NOT EXISTS (SELECT 1 FROM ledger_entries le WHERE le.assessment_id = assessments.id AND le.type_id = 4);
@@ -17,7 +17,7 @@ import { Login } from "./pages/Login/Login";
 import { Register } from "./pages/Register/Register";
 import { LoginContext } from "./pages/Login/LoginContext";
 import { useCallback, useMemo, useState } from "react";
-import { userMe } from "./utils/requests";
+import { clearTokens, userMe } from "./utils/requests";
 import { UserStatPage } from "./pages/UserStatPage/UserStatPage";
 import { UserList } from "./pages/UserList/UserList";
 
@@ -31,7 +31,7 @@ export const App = () => {
 
   const handleUpdateUser = useCallback((token: string) => {
     if (!token) {
-      localStorage.removeItem("token");
+      clearTokens();
       setUserName("");
       setUserRole("");
       setUserToken("");
@@ -4,13 +4,28 @@ import { BatchCardType } from "../../utils/types";
 import "./BatchCard.scss";
 import { Link } from "react-router";
 import { PencilToLine } from "@gravity-ui/icons";
-import { useEffect, useRef } from "react";
-import { batchUpdate } from "../../utils/requests";
+import { batchSetStatus } from "../../utils/requests";
 
 const b = block("batch-card");
 
 const _ = require("lodash");
 
+const BATCH_STATUS_ACTIVE = 3;
+const BATCH_STATUS_PAUSED = 4;
+
+// Statuses that batch can be activated from, as backend lifecycle allows.
+// Active batch can always be paused, archived batch can not be changed.
+const ACTIVATABLE_STATUSES = [1, 2, 4, 5];
+
+const statusNames: Record<number, string> = {
+  1: "черновик",
+  2: "запланирован",
+  3: "активен",
+  4: "приостановлен",
+  5: "завершен",
+  6: "в архиве",
+};
+
 type BatchCardProps = {
   batch: BatchCardType;
   handleUpdateBatch: (batch: BatchCardType) => void;
@@ -22,23 +37,26 @@ export const BatchCard = ({
   triggerRerender,
   handleUpdateBatch,
 }: BatchCardProps) => {
-  const wasUpdated = useRef(false);
+  const canToggle =
+    batch.status_id === BATCH_STATUS_ACTIVE ||
+    ACTIVATABLE_STATUSES.includes(batch.status_id);
 
+  // Status is updated optimistically and rolled back if backend rejects the transition.
+  // Errors may be turned into responses by interceptor, so status of response is checked as well.
   const handleUpdateStatus = (checked: boolean) => {
+    const previous = batch;
     const batchCopy = _.cloneDeep(batch);
-    batchCopy.is_active = checked;
+    batchCopy.status_id = checked ? BATCH_STATUS_ACTIVE : BATCH_STATUS_PAUSED;
     handleUpdateBatch(batchCopy);
-    wasUpdated.current = true;
-  };
 
-  useEffect(() => {
-    if (wasUpdated.current) {
-      batchUpdate(batch).then(() => {
-        "nothing";
-      });
-    }
-    wasUpdated.current = false;
-  }, [batch.is_active]);
+    batchSetStatus(batch.id, batchCopy.status_id)
+      .then((response) => {
+        if (!response || response.status !== 200) {
+          handleUpdateBatch(previous);
+        }
+      })
+      .catch(() => handleUpdateBatch(previous));
+  };
 
   return (
     <div className={b()}>
@@ -53,7 +71,8 @@ export const BatchCard = ({
           <div className={b("toggle")}>
             <div>Проект в работе у ассессоров?</div>
             <Switch
-              checked={batch.is_active}
+              checked={batch.status_id === BATCH_STATUS_ACTIVE}
+              disabled={!canToggle}
               onUpdate={handleUpdateStatus}
             ></Switch>
           </div>
@@ -65,7 +84,7 @@ export const BatchCard = ({
             Количество пересечений: {batch.overlaps} <br></br>
             Приоритет: {batch.priority} <br></br>
             Проект находится в статусе "
-            {batch.is_active ? "активен" : "неактивен"}" <br></br>
+            {statusNames[batch.status_id]}" <br></br>
             Тип разметки:{" "}
             {batch.type_id === 1
               ? "простой набор полей"
@@ -8,6 +8,7 @@ import { toaster } from "@gravity-ui/uikit/toaster-singleton";
 import { useContext, useEffect } from "react";
 import { LoginContext } from "../../pages/Login/LoginContext";
 import { ButtonWithConfirm } from "../ButtonWithConfirm/ButtonWithConfirm";
+import { handleLogout } from "../../utils/requests";
 
 const b = block("sidebar");
 
@@ -80,8 +81,10 @@ export const Sidebar = () => {
             <ButtonWithConfirm
               confirmText="Подтвердите, что хотите выйти из аккаунта"
               handleSubmit={() => {
-                loginContext.updateUser("");
-                navigate("/login");
+                handleLogout().finally(() => {
+                  loginContext.updateUser("");
+                  navigate("/login");
+                });
               }}
             >
               <Button view="action">Выйти из аккаунта</Button>
@@ -2,7 +2,7 @@ import { Button, TextInput } from "@gravity-ui/uikit";
 import { block } from "../../utils/block";
 import "./Login.scss";
 import { useContext, useState } from "react";
-import { handleLogin } from "../../utils/requests";
+import { handleLogin, saveTokens } from "../../utils/requests";
 import { toaster } from "@gravity-ui/uikit/toaster-singleton";
 import { sleep } from "../../utils/utils";
 import { useNavigate } from "react-router";
@@ -27,6 +27,7 @@ export const Login = () => {
           content: "Вы успешно авторизовались",
           theme: "success",
         });
+        saveTokens(response);
         loginContext.updateUser(response.token);
         await sleep(500);
         navigate("/");
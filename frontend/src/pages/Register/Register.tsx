@@ -2,7 +2,7 @@ import { Button, TextInput } from "@gravity-ui/uikit";
 import { block } from "../../utils/block";
 import "./Register.scss";
 import { useContext, useState } from "react";
-import { handleLogin, handleRegister } from "../../utils/requests";
+import { handleLogin, handleRegister, saveTokens } from "../../utils/requests";
 import { toaster } from "@gravity-ui/uikit/toaster-singleton";
 import { sleep } from "../../utils/utils";
 import { useNavigate } from "react-router";
@@ -38,6 +38,7 @@ export const Register = () => {
             content: "Вы успешно зарегистрировались",
             theme: "success",
           });
+          saveTokens(response);
           loginContext.updateUser(response.token);
           await sleep(500);
           navigate("/");
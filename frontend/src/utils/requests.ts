@@ -15,6 +15,78 @@ const getAuthHeaders = () => {
   return token ? { Authorization: `Bearer ${token}` } : {};
 };
 
+// saveTokens stores access and refresh tokens returned by login or refresh.
+export const saveTokens = (tokens: {
+  token: string;
+  refresh_token?: string;
+}) => {
+  localStorage.setItem("token", tokens.token);
+  if (tokens.refresh_token) {
+    localStorage.setItem("refresh_token", tokens.refresh_token);
+  }
+};
+
+export const clearTokens = () => {
+  localStorage.removeItem("token");
+  localStorage.removeItem("refresh_token");
+};
+
+// Refresh token is rotated on every use, so concurrent requests share a single refresh.
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem("refresh_token");
+    refreshing = (
+      refreshToken
+        ? axios
+            .post(API_PREFIX + "/api/v1/auth/refresh", {
+              refresh_token: refreshToken,
+            })
+            .then((response) => {
+              saveTokens(response.data);
+              return response.data.token as string;
+            })
+        : Promise.reject(new Error("no refresh token"))
+    ).finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+};
+
+// Requests that fail with 401 because access token has expired are retried once
+// with refreshed token. If refresh fails, tokens are removed and the error is returned.
+axios.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const config = error.config;
+    const isAuthRequest = [
+      "/auth/login",
+      "/auth/register",
+      "/auth/refresh",
+    ].some((path) => config?.url?.includes(path));
+    if (
+      error.response?.status !== 401 ||
+      !config ||
+      config._retried ||
+      isAuthRequest
+    ) {
+      return Promise.reject(error);
+    }
+    config._retried = true;
+
+    try {
+      const token = await refreshAccessToken();
+      config.headers.Authorization = `Bearer ${token}`;
+      return axios(config);
+    } catch {
+      clearTokens();
+      return Promise.reject(error);
+    }
+  }
+);
+
 export const handleCreateMarkupType = async (request: MarkupTypeRq) => {
   return await axios
     .post(API_PREFIX + "/api/v1/markupTypes", request, {
@@ -118,6 +190,14 @@ export const batchUpdate = async (batch: BatchCardType) => {
   );
 };
 
+export const batchSetStatus = async (batchId: number, statusId: number) => {
+  return await axios.put(
+    API_PREFIX + "/api/v1/batches/" + batchId + "/status",
+    { status_id: statusId },
+    { headers: getAuthHeaders() }
+  );
+};
+
 export const getLinkedMarkupsToBatch = async (
   batchId: number,
   page: number,
@@ -240,6 +320,19 @@ export const handleLogin = async (email: string, password: string) => {
     .then((response) => response.data);
 };
 
+export const handleLogout = async () => {
+  const refreshToken = localStorage.getItem("refresh_token");
+  return await axios
+    .post(
+      API_PREFIX + "/api/v1/auth/logout",
+      { refresh_token: refreshToken ?? "" },
+      {
+        headers: getAuthHeaders(),
+      }
+    )
+    .then((response) => response.data);
+};
+
 export const handleRegister = async (email: string, password: string) => {
   return await axios
     .post(API_PREFIX + "/api/v1/auth/register", {
@@ -43,7 +43,9 @@ export type BatchCardType = {
   overlaps: number;
   priority: number;
   created_at: string;
-  is_active: boolean;
+  status_id: number;
+  starts_at: string | null;
+  ends_at: string | null;
   type_id: number;
 };
 